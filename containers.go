@@ -7,71 +7,130 @@ import (
 	"strings"
 )
 
-// extractVector 解析一个动态长度的 vector，并返回逗号分隔的值字符串及字节数
-func extractVector(data []byte, types []interface{}, offset int, argType interface{}) (string, int) {
+// extractVectorWithDepth 解析一个动态长度的 vector，返回元素切片及字节数
+func extractVectorWithDepth(data []byte, ctx *decodeContext, offset int, elem *typePlan, depth int) (interface{}, int) {
 	// 1. 读出长度（4 字节小端）
+	if offset < 0 || len(data)-offset < 4 {
+		ctx.failStrict(offset, ErrTruncatedData, "missing vec length")
+		return nil, 0
+	}
 	length := int(binary.LittleEndian.Uint32(data[offset : offset+4]))
 	n := 4
 
-	// 2. 预分配 slice
-	res := make([]string, 0, length)
+	// 2. 预分配 slice，长度不可信时不超过剩余字节数
+	res := make([]interface{}, 0, min(length, len(data)-offset-n))
 
-	// 3. 循环提取并高效转换
+	// 3. 循环提取，数据耗尽、出错或元素不占字节时停止，避免按数据里不可信的长度空转
 	for i := 0; i < length; i++ {
-		val, n_i := extractValue(data, types, offset+n, argType)
+		if offset+n >= len(data) {
+			ctx.failStrict(offset+n, ErrTruncatedData, "vec has %d of %d items", i, length)
+			break
+		}
+		ctx.pushIndex(i)
+		val, n_i := extractValueWithDepth(data, ctx, offset+n, elem, depth)
+		if n_i == 0 {
+			ctx.fail(offset+n, ErrInvalidData, "vec item decoded from 0 bytes")
+		}
+		ctx.pop()
 		n += n_i
-
-		// 类型断言 & strconv 转换
-		switch v := val.(type) {
-		case string:
-			res = append(res, v)
-		case int:
-			res = append(res, strconv.Itoa(v))
-		case int64:
-			res = append(res, strconv.FormatInt(v, 10))
-		case uint64:
-			res = append(res, strconv.FormatUint(v, 10))
-		case float64:
-			res = append(res, strconv.FormatFloat(v, 'f', -1, 64))
-		case bool:
-			res = append(res, strconv.FormatBool(v))
-		default:
-			// 最坏情况回落到 fmt.Sprint
-			res = append(res, fmt.Sprint(v))
+		res = append(res, val)
+		if ctx.err != nil {
+			break
 		}
 	}
 
-	// 4. 一次性拼接
-	return strings.Join(res, ", "), n
+	if ctx.legacyStrings {
+		return legacyJoin(res), n
+	}
+	return res, n
 }
 
-// extractArray 解析定长 array，内部 args 类型由 IDL 给出
-func extractArray(data []byte, types []interface{}, offset int, argType interface{}) (string, int) {
-	// 1. 从 argType 中拿到 (elemType, length)
-	meta, ok := argType.([]interface{})
-	if !ok {
-		return "", 0
-	}
-	rawLen := meta[1]
-	length := 0
-	switch v := rawLen.(type) {
-	case int:
-		length = v
-	case float64:
-		length = int(v)
-	default:
-		// 不常见类型：直接设置 0
-		length = 0
+// extractArrayWithDepth 解析定长 array，内部 args 类型由 IDL 给出
+func extractArrayWithDepth(data []byte, ctx *decodeContext, offset int, argType *IdlTypeArray, elem *typePlan, depth int) (interface{}, int) {
+	// 1. 从 argType 中拿到 (elemType, length)，未替换的泛型长度无法解析
+	if argType.Len.Generic != "" {
+		ctx.fail(offset, ErrUnsupportedType, "unresolved array length %s", argType.Len.Generic)
+		return nil, 0
 	}
+	length := argType.Len.Value
 
 	n := 0
-	res := make([]string, 0, length)
+	res := make([]interface{}, 0, min(length, max(len(data)-offset, 0)))
 
-	// 2. 按长度循环
+	// 2. 按长度循环，数据耗尽或出错时停止；长度来自 IDL，
+	// 空结构体这类零大小元素是合法的，不需要数据
 	for i := 0; i < length; i++ {
-		val, n_i := extractValue(data, types, offset+n, meta[0])
+		if elem.size != 0 && offset+n >= len(data) {
+			ctx.failStrict(offset+n, ErrTruncatedData, "array has %d of %d items", i, length)
+			break
+		}
+		ctx.pushIndex(i)
+		val, n_i := extractValueWithDepth(data, ctx, offset+n, elem, depth)
+		if n_i == 0 && elem.size != 0 {
+			ctx.failStrict(offset+n, ErrInvalidData, "array item decoded from 0 bytes")
+		}
+		ctx.pop()
 		n += n_i
+		res = append(res, val)
+		if ctx.err != nil {
+			break
+		}
+	}
+
+	if ctx.legacyStrings {
+		return legacyJoin(res), n
+	}
+	return res, n
+}
 
+// extractOptionWithDepth 解析 borsh option：1 字节标记（0 为 None，1 为 Some）后接内部值
+func extractOptionWithDepth(data []byte, ctx *decodeContext, offset int, elem *typePlan, depth int) (interface{}, int) {
+	if offset < 0 || offset >= len(data) {
+		ctx.failStrict(offset, ErrTruncatedData, "missing option tag")
+		return nil, 0
+	}
+	switch data[offset] {
+	case 0:
+		return nil, 1
+	case 1:
+		val, n := extractValueWithDepth(data, ctx, offset+1, elem, depth)
+		return val, 1 + n
+	default:
+		// 非法标记：只跳过标记字节
+		ctx.failStrict(offset, ErrInvalidData, "invalid option tag %d", data[offset])
+		return nil, 1
+	}
+}
+
+// extractCOptionWithDepth 解析 SPL 风格的 COption：4 字节小端标记，
+// 内部值无论 None 还是 Some 都占用固定大小，大小在编译 plan 时算好
+func extractCOptionWithDepth(data []byte, ctx *decodeContext, offset int, plan *typePlan, depth int) (interface{}, int) {
+	size := plan.elem.size
+	if size < 0 {
+		ctx.fail(offset, ErrUnsupportedType, "coption of variable sized %s", plan.argType.COption)
+		return nil, 0
+	}
+	if offset < 0 || len(data)-offset < 4+size {
+		ctx.failStrict(offset, ErrTruncatedData, "coption needs %d bytes", 4+size)
+		return nil, 4 + size
+	}
+	switch tag := binary.LittleEndian.Uint32(data[offset : offset+4]); tag {
+	case 0:
+		return nil, 4 + size
+	case 1:
+		val, _ := extractValueWithDepth(data, ctx, offset+4, plan.elem, depth)
+		return val, 4 + size
+	default:
+		ctx.failStrict(offset, ErrInvalidData, "invalid coption tag %d", tag)
+		return nil, 4 + size
+	}
+}
+
+// legacyJoin 把元素转换为逗号分隔的字符串，兼容旧版输出
+func legacyJoin(values []interface{}) string {
+	res := make([]string, 0, len(values))
+	for _, val := range values {
+		// 类型断言 & strconv 转换
 		switch v := val.(type) {
 		case string:
 			res = append(res, v)
@@ -86,9 +145,18 @@ func extractArray(data []byte, types []interface{}, offset int, argType interfac
 		case bool:
 			res = append(res, strconv.FormatBool(v))
 		default:
+			// 最坏情况回落到 fmt.Sprint
 			res = append(res, fmt.Sprint(v))
 		}
 	}
+	// 一次性拼接
+	return strings.Join(res, ", ")
+}
 
-	return strings.Join(res, ", "), n
+func bytesToValues(b []byte) []interface{} {
+	res := make([]interface{}, len(b))
+	for i, v := range b {
+		res[i] = v
+	}
+	return res
 }
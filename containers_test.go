@@ -0,0 +1,144 @@
+package anchor_idl_parser
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const containersIdl = `{
+  "address": "Cont111111111111111111111111111111111111111",
+  "metadata": {"name": "containers", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "enums", "discriminator": [1, 0, 0, 0, 0, 0, 0, 0], "accounts": [],
+     "args": [{"name": "items", "type": {"vec": {"defined": {"name": "E"}}}}]},
+    {"name": "empties", "discriminator": [2, 0, 0, 0, 0, 0, 0, 0], "accounts": [],
+     "args": [{"name": "items", "type": {"vec": {"defined": {"name": "Empty"}}}}]},
+    {"name": "fixed", "discriminator": [3, 0, 0, 0, 0, 0, 0, 0], "accounts": [],
+     "args": [{"name": "items", "type": {"array": [{"defined": {"name": "E"}}, 1000000]}}]},
+    {"name": "bytes", "discriminator": [4, 0, 0, 0, 0, 0, 0, 0], "accounts": [],
+     "args": [{"name": "items", "type": {"vec": "u8"}}]},
+    {"name": "empty_array", "discriminator": [5, 0, 0, 0, 0, 0, 0, 0], "accounts": [],
+     "args": [{"name": "items", "type": {"array": [{"defined": {"name": "Empty"}}, 3]}}]},
+    {"name": "enum_then", "discriminator": [6, 0, 0, 0, 0, 0, 0, 0], "accounts": [],
+     "args": [{"name": "e", "type": {"defined": {"name": "E"}}}, {"name": "x", "type": "u8"}]}
+  ],
+  "types": [
+    {"name": "E", "type": {"kind": "enum", "variants": [{"name": "A"}, {"name": "B"}]}},
+    {"name": "Empty", "type": {"kind": "struct", "fields": []}}
+  ]
+}`
+
+// containersData prefixes payload with the discriminator of an instruction
+// of containersIdl.
+func containersData(discriminator byte, payload ...byte) []byte {
+	return append([]byte{discriminator, 0, 0, 0, 0, 0, 0, 0}, payload...)
+}
+
+func TestExtractVectorUntrustedLength(t *testing.T) {
+	p, err := NewParserWithJson(containersIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		// lenient is set when lenient decoding fails too
+		lenient bool
+	}{
+		{"bad enum tag", containersData(1, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0), false},
+		{"empty struct", containersData(2, 0xff, 0xff, 0xff, 0xff, 0), true},
+		{"bad enum tag array", containersData(3, 0xff, 0, 0, 0), false},
+	}
+	for _, strict := range []bool{false, true} {
+		p.SetStrict(strict)
+		for _, tt := range tests {
+			start := time.Now()
+			_, err := p.InstructionParse(tt.data)
+			if (strict || tt.lenient) && !errors.Is(err, ErrInvalidData) {
+				t.Errorf("%s (strict %v): got %v, want ErrInvalidData", tt.name, strict, err)
+			}
+			if !strict && !tt.lenient && err != nil {
+				t.Errorf("%s (strict %v): got %v", tt.name, strict, err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("%s (strict %v): took %v", tt.name, strict, elapsed)
+			}
+		}
+	}
+}
+
+func TestExtractVectorTruncated(t *testing.T) {
+	p, err := NewParserWithJson(containersIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := containersData(4, 0xff, 0xff, 0xff, 0xff, 1, 2, 3)
+	res, err := p.InstructionParse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items := res["data"].(map[string]interface{})["items"].([]interface{}); len(items) != 3 {
+		t.Errorf("got %d items, want 3", len(items))
+	}
+
+	p.SetStrict(true)
+	if _, err := p.InstructionParse(data); !errors.Is(err, ErrTruncatedData) {
+		t.Errorf("got %v, want ErrTruncatedData", err)
+	}
+}
+
+func TestExtractArrayUnresolvedLength(t *testing.T) {
+	p, err := NewParserWithJson(`{
+  "address": "Cont111111111111111111111111111111111111111",
+  "metadata": {"name": "containers", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "generic", "discriminator": [1, 0, 0, 0, 0, 0, 0, 0], "accounts": [],
+     "args": [{"name": "items", "type": {"array": ["u8", {"generic": "N"}]}}]}
+  ]
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.InstructionParse(containersData(1, 2, 3)); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("got %v, want ErrUnsupportedType", err)
+	}
+}
+
+func TestExtractZeroSizedArray(t *testing.T) {
+	p, err := NewParserWithJson(containersIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, strict := range []bool{false, true} {
+		p.SetStrict(strict)
+		res, err := p.InstructionParse(containersData(5))
+		if err != nil {
+			t.Errorf("strict %v: %v", strict, err)
+			continue
+		}
+		if items := res["data"].(map[string]interface{})["items"].([]interface{}); len(items) != 3 {
+			t.Errorf("strict %v: got %d items, want 3", strict, len(items))
+		}
+	}
+}
+
+func TestExtractEnumOutOfRange(t *testing.T) {
+	p, err := NewParserWithJson(containersIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := p.InstructionParse(containersData(6, 9, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := res["data"].(map[string]interface{})
+	if values["e"] != nil || values["x"] != uint8(7) {
+		t.Errorf("got %v", values)
+	}
+
+	p.SetStrict(true)
+	if _, err := p.InstructionParse(containersData(6, 9, 7)); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("got %v, want ErrInvalidData", err)
+	}
+}
@@ -0,0 +1,322 @@
+package anchor_idl_parser
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/bytedance/sonic"
+	"github.com/heroims/anchor-idl-parser-go/utils"
+)
+
+// idlSpecVersion is the IDL spec version written by converted IDLs.
+const idlSpecVersion = "0.1.0"
+
+// ConvertLegacyIdl returns the 0.30+ spec form of idl, leaving idl itself
+// untouched. Legacy IDLs get computed discriminators, snake_case instruction,
+// account and field names, pubkey instead of publicKey, account and event
+// layouts moved into types, byte array const seeds and the program address,
+// name and version moved to address and metadata. IDLs already in the new
+// spec, which have metadata.spec or discriminators, keep their names.
+func ConvertLegacyIdl(idl *Idl) (*Idl, error) {
+	b, err := sonic.Marshal(idl)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdl, err)
+	}
+	res := &Idl{}
+	if err := sonic.Unmarshal(b, res); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdl, err)
+	}
+	if err := res.Validate(); err != nil {
+		return nil, err
+	}
+	if err := normalizeIdl(res, true); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ConvertLegacyIdlJson converts legacy IDL JSON like ConvertLegacyIdl.
+func ConvertLegacyIdlJson(idlJson string) (string, error) {
+	idl := &Idl{}
+	if err := sonic.Unmarshal([]byte(idlJson), idl); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidIdl, err)
+	}
+	if err := idl.Validate(); err != nil {
+		return "", err
+	}
+	if err := normalizeIdl(idl, true); err != nil {
+		return "", err
+	}
+	b, err := sonic.MarshalIndent(idl, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidIdl, err)
+	}
+	return string(b), nil
+}
+
+// normalizeIdl rewrites idl in place into the new spec. The parser runs it
+// with convert off, so decoded output keeps the names of the IDL it was given
+// and seeds that cannot be converted are left alone. Converting an IDL that
+// is already in the new spec leaves its names alone as well.
+func normalizeIdl(idl *Idl, convert bool) error {
+	n := &idlNormalizer{convert: convert && !isNewSpec(idl)}
+	if idl.Address == "" {
+		idl.Address = idl.Metadata.Address
+	}
+	idl.Metadata.Address = ""
+	if idl.Metadata.Name == "" {
+		idl.Metadata.Name = idl.Name
+	}
+	if idl.Metadata.Version == "" {
+		idl.Metadata.Version = idl.Version
+	}
+	if idl.Metadata.Spec == "" {
+		idl.Metadata.Spec = idlSpecVersion
+	}
+	idl.Name, idl.Version = "", ""
+
+	for i := range idl.Instructions {
+		ins := &idl.Instructions[i]
+		if ins.Discriminator == nil {
+			ins.Discriminator = sighash("global", utils.ToSnakeCase(ins.Name))
+		}
+		ins.Name = n.name(ins.Name)
+		if err := n.accountItems(ins.Accounts); err != nil {
+			return fmt.Errorf("%w: instruction %s: %v", ErrInvalidIdl, ins.Name, err)
+		}
+		n.fields(ins.Args)
+		if ins.Returns != nil {
+			n.typ(ins.Returns)
+		}
+	}
+
+	for i := range idl.Types {
+		n.typeDefTy(&idl.Types[i].Type)
+	}
+	for i := range idl.Accounts {
+		account := &idl.Accounts[i]
+		if account.Discriminator == nil {
+			account.Discriminator = sighash("account", account.Name)
+		}
+		if account.Type != nil {
+			n.typeDefTy(account.Type)
+			setTypeDef(idl, IdlTypeDef{Name: account.Name, Type: *account.Type})
+			account.Type = nil
+		}
+	}
+	for i := range idl.Events {
+		event := &idl.Events[i]
+		if event.Discriminator == nil {
+			event.Discriminator = sighash("event", event.Name)
+		}
+		if event.Fields != nil {
+			n.fields(event.Fields)
+			setTypeDef(idl, IdlTypeDef{Name: event.Name, Type: IdlTypeDefTy{
+				Kind:   IdlTypeDefKindStruct,
+				Fields: &IdlDefinedFields{Named: event.Fields},
+			}})
+			event.Fields = nil
+		}
+	}
+	for i := range idl.Constants {
+		n.typ(&idl.Constants[i].Type)
+	}
+	return nil
+}
+
+// isNewSpec reports whether idl is in the 0.30+ spec, which legacy IDLs
+// never have metadata.spec or discriminators of.
+func isNewSpec(idl *Idl) bool {
+	if idl.Metadata.Spec != "" {
+		return true
+	}
+	for i := range idl.Instructions {
+		if idl.Instructions[i].Discriminator != nil {
+			return true
+		}
+	}
+	for i := range idl.Accounts {
+		if idl.Accounts[i].Discriminator != nil {
+			return true
+		}
+	}
+	for i := range idl.Events {
+		if idl.Events[i].Discriminator != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func sighash(namespace string, name string) IdlDiscriminator {
+	hash := sha256.Sum256([]byte(namespace + ":" + name))
+	return hash[:8]
+}
+
+// setTypeDef adds typeDef to the IDL types, replacing a type of the same
+// name since inline legacy layouts take precedence.
+func setTypeDef(idl *Idl, typeDef IdlTypeDef) {
+	for i := range idl.Types {
+		if idl.Types[i].Name == typeDef.Name {
+			idl.Types[i] = typeDef
+			return
+		}
+	}
+	idl.Types = append(idl.Types, typeDef)
+}
+
+type idlNormalizer struct {
+	convert bool
+}
+
+func (n *idlNormalizer) name(name string) string {
+	if !n.convert {
+		return name
+	}
+	return utils.ToSnakeCase(name)
+}
+
+func (n *idlNormalizer) path(path string) string {
+	if !n.convert {
+		return path
+	}
+	parts := strings.Split(path, ".")
+	for i := range parts {
+		parts[i] = utils.ToSnakeCase(parts[i])
+	}
+	return strings.Join(parts, ".")
+}
+
+func (n *idlNormalizer) accountItems(items []IdlInstructionAccountItem) error {
+	for i := range items {
+		item := &items[i]
+		item.Name = n.name(item.Name)
+		for j := range item.Relations {
+			item.Relations[j] = n.name(item.Relations[j])
+		}
+		if item.Pda != nil {
+			for j := range item.Pda.Seeds {
+				if err := n.seed(&item.Pda.Seeds[j]); err != nil {
+					return err
+				}
+			}
+			if item.Pda.Program != nil {
+				if err := n.seed(item.Pda.Program); err != nil {
+					return err
+				}
+			}
+		}
+		if err := n.accountItems(item.Accounts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seed turns legacy typed seeds into new-spec seeds, where const values are
+// byte arrays and arg and account seeds carry only a path.
+func (n *idlNormalizer) seed(seed *IdlSeed) error {
+	seed.Path = n.path(seed.Path)
+	if seed.Type == nil {
+		return nil
+	}
+	if seed.Kind == "const" {
+		value, err := constSeedBytes(seed.Type, seed.Value)
+		if err != nil {
+			if !n.convert {
+				return nil
+			}
+			return err
+		}
+		values := make([]interface{}, len(value))
+		for i, b := range value {
+			values[i] = int(b)
+		}
+		seed.Value = values
+	}
+	seed.Type = nil
+	return nil
+}
+
+func constSeedBytes(seedType *IdlType, value interface{}) ([]byte, error) {
+	switch seedType.Primitive {
+	case "string":
+		if s, ok := value.(string); ok {
+			return []byte(s), nil
+		}
+	case "pubkey", "publicKey":
+		if s, ok := value.(string); ok {
+			if key := base58.Decode(s); len(key) == 32 {
+				return key, nil
+			}
+		}
+	case "bytes":
+		return toBytes(value)
+	default:
+		if size, ok := primitiveSizes[seedType.Primitive]; ok && seedType.Primitive != "bool" && seedType.Primitive[0] != 'f' {
+			v, err := toBigInt(value)
+			if err != nil {
+				return nil, err
+			}
+			return appendInteger(nil, v, size, seedType.Primitive[0] == 'i', "")
+		}
+	}
+	if seedType.Array != nil || seedType.Vec != nil {
+		return toBytes(value)
+	}
+	return nil, fmt.Errorf("const seed %v of type %s", value, seedType)
+}
+
+func (n *idlNormalizer) typeDefTy(typeData *IdlTypeDefTy) {
+	if typeData.Fields != nil {
+		n.definedFields(typeData.Fields)
+	}
+	for i := range typeData.Variants {
+		if typeData.Variants[i].Fields != nil {
+			n.definedFields(typeData.Variants[i].Fields)
+		}
+	}
+	if typeData.Alias != nil {
+		n.typ(typeData.Alias)
+	}
+}
+
+func (n *idlNormalizer) definedFields(fields *IdlDefinedFields) {
+	if fields.IsTuple() {
+		for i := range fields.Tuple {
+			n.typ(&fields.Tuple[i])
+		}
+		return
+	}
+	n.fields(fields.Named)
+}
+
+func (n *idlNormalizer) fields(fields []IdlField) {
+	for i := range fields {
+		fields[i].Name = n.name(fields[i].Name)
+		n.typ(&fields[i].Type)
+	}
+}
+
+func (n *idlNormalizer) typ(t *IdlType) {
+	switch {
+	case t.Primitive == "publicKey":
+		t.Primitive = "pubkey"
+	case t.Option != nil:
+		n.typ(t.Option)
+	case t.COption != nil:
+		n.typ(t.COption)
+	case t.Vec != nil:
+		n.typ(t.Vec)
+	case t.Array != nil:
+		n.typ(&t.Array.Elem)
+	case t.Defined != nil:
+		for i := range t.Defined.Generics {
+			if t.Defined.Generics[i].Type != nil {
+				n.typ(t.Defined.Generics[i].Type)
+			}
+		}
+	}
+}
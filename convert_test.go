@@ -0,0 +1,149 @@
+package anchor_idl_parser
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bytedance/sonic"
+)
+
+const legacyConvertIdl = `{
+  "version": "0.1.0",
+  "name": "amm",
+  "instructions": [
+    {"name": "initializePool", "accounts": [
+      {"name": "poolState", "isMut": true, "isSigner": false, "pda": {"seeds": [
+        {"kind": "const", "type": "string", "value": "pool"},
+        {"kind": "arg", "type": "u64", "path": "poolId"},
+        {"kind": "account", "type": "publicKey", "account": "Mint", "path": "tokenMint"}
+      ]}},
+      {"name": "payer", "isMut": true, "isSigner": true},
+      {"name": "tokenMint", "isMut": false, "isSigner": false}
+    ], "args": [
+      {"name": "poolId", "type": "u64"},
+      {"name": "config", "type": {"defined": "Config"}}
+    ]}
+  ],
+  "accounts": [
+    {"name": "Pool", "type": {"kind": "struct", "fields": [
+      {"name": "authority", "type": "publicKey"},
+      {"name": "feeBps", "type": "u16"}
+    ]}}
+  ],
+  "events": [
+    {"name": "Swapped", "fields": [{"name": "amountIn", "type": "u64", "index": false}]}
+  ],
+  "types": [
+    {"name": "Config", "type": {"kind": "struct", "fields": [{"name": "maxAmount", "type": {"option": "u64"}}]}}
+  ],
+  "metadata": {"address": "Conv111111111111111111111111111111111111111"}
+}`
+
+const convertedIdl = `{
+  "address": "Conv111111111111111111111111111111111111111",
+  "metadata": {"name": "amm", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "initialize_pool", "discriminator": [95, 180, 10, 172, 84, 174, 232, 40], "accounts": [
+      {"name": "pool_state", "writable": true, "pda": {"seeds": [
+        {"kind": "const", "value": [112, 111, 111, 108]},
+        {"kind": "arg", "path": "pool_id"},
+        {"kind": "account", "path": "token_mint", "account": "Mint"}
+      ]}},
+      {"name": "payer", "writable": true, "signer": true},
+      {"name": "token_mint"}
+    ], "args": [
+      {"name": "pool_id", "type": "u64"},
+      {"name": "config", "type": {"defined": {"name": "Config"}}}
+    ]}
+  ],
+  "accounts": [{"name": "Pool", "discriminator": [241, 154, 109, 4, 17, 177, 109, 188]}],
+  "events": [{"name": "Swapped", "discriminator": [217, 52, 52, 83, 147, 135, 96, 109]}],
+  "types": [
+    {"name": "Config", "type": {"kind": "struct", "fields": [{"name": "max_amount", "type": {"option": "u64"}}]}},
+    {"name": "Pool", "type": {"kind": "struct", "fields": [
+      {"name": "authority", "type": "pubkey"},
+      {"name": "fee_bps", "type": "u16"}
+    ]}},
+    {"name": "Swapped", "type": {"kind": "struct", "fields": [{"name": "amount_in", "type": "u64"}]}}
+  ]
+}`
+
+// jsonValue unmarshals JSON for comparisons that ignore layout.
+func jsonValue(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestConvertLegacyIdlJson(t *testing.T) {
+	res, err := ConvertLegacyIdlJson(legacyConvertIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := jsonValue(t, res), jsonValue(t, convertedIdl); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %s", res)
+	}
+}
+
+func TestConvertLegacyIdl(t *testing.T) {
+	idl := &Idl{}
+	if err := sonic.Unmarshal([]byte(legacyConvertIdl), idl); err != nil {
+		t.Fatal(err)
+	}
+	res, err := ConvertLegacyIdl(idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := sonic.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := jsonValue(t, string(b)), jsonValue(t, convertedIdl); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %s", b)
+	}
+	// the input is left untouched
+	if idl.Instructions[0].Name != "initializePool" || idl.Accounts[0].Type == nil {
+		t.Errorf("input changed: %+v", idl.Instructions[0])
+	}
+
+	idl.Instructions[0].Name = ""
+	if _, err := ConvertLegacyIdl(idl); !errors.Is(err, ErrInvalidIdl) {
+		t.Errorf("got %v, want ErrInvalidIdl", err)
+	}
+}
+
+func TestConvertNewSpecIdl(t *testing.T) {
+	newSpec := `{
+  "address": "Conv111111111111111111111111111111111111111",
+  "metadata": {"name": "new_spec", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "doIt", "discriminator": [1], "accounts": [{"name": "fooBar", "writable": true}],
+     "args": [{"name": "someArg", "type": "u8"}]}
+  ]
+}`
+	res, err := ConvertLegacyIdlJson(newSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := jsonValue(t, res), jsonValue(t, newSpec); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %s", res)
+	}
+
+	// the parser's IDL is already converted and keeps its names too
+	p, err := NewParserWithJson(legacyConvertIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idl, err := ConvertLegacyIdl(p.GetIdl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := idl.Instructions[0].Name; name != "initializePool" {
+		t.Errorf("got %s", name)
+	}
+}
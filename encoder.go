@@ -0,0 +1,478 @@
+package anchor_idl_parser
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+// encodeContext carries the IDL through an encode, mirroring decodeContext.
+type encodeContext struct {
+	*typeEnv
+}
+
+func encodeArgs(buf []byte, ctx *encodeContext, args []IdlField, values interface{}, path string) ([]byte, error) {
+	fields, err := toFieldGetter(values, path)
+	if err != nil {
+		return nil, err
+	}
+	for i := range args {
+		fieldPath := joinPath(path, args[i].Name)
+		value, ok := fields(args[i].Name)
+		if !ok {
+			return nil, newEncodeError(fieldPath, ErrInvalidValue, "missing value")
+		}
+		buf, err = encodeValueWithDepth(buf, ctx, value, &args[i].Type, fieldPath, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func encodeValueWithDepth(buf []byte, ctx *encodeContext, value interface{}, argType *IdlType, path string, depth int) ([]byte, error) {
+	if depth > maxRecursiveDepth {
+		return nil, newEncodeError(path, ErrMaxDepthExceeded, "max recursive depth exceeded")
+	}
+	switch {
+	case argType.Primitive != "":
+		return encodePrimitive(buf, value, argType.Primitive, path)
+	case argType.Vec != nil:
+		items, err := toSlice(value, path)
+		if err != nil {
+			return nil, err
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(items)))
+		for i, item := range items {
+			buf, err = encodeValueWithDepth(buf, ctx, item, argType.Vec, fmt.Sprintf("%s[%d]", path, i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case argType.Array != nil:
+		items, err := toSlice(value, path)
+		if err != nil {
+			return nil, err
+		}
+		if argType.Array.Len.Generic != "" {
+			return nil, newEncodeError(path, ErrUnsupportedType, "unresolved array length %s", argType.Array.Len.Generic)
+		}
+		if len(items) != argType.Array.Len.Value {
+			return nil, newEncodeError(path, ErrInvalidValue, "expected %d items, got %d", argType.Array.Len.Value, len(items))
+		}
+		for i, item := range items {
+			buf, err = encodeValueWithDepth(buf, ctx, item, &argType.Array.Elem, fmt.Sprintf("%s[%d]", path, i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case argType.Option != nil:
+		if isNil(value) {
+			return append(buf, 0), nil
+		}
+		return encodeValueWithDepth(append(buf, 1), ctx, value, argType.Option, path, depth+1)
+	case argType.COption != nil:
+		size, ok := fixedSizeOf(ctx.typeEnv, argType.COption)
+		if !ok {
+			return nil, newEncodeError(path, ErrUnsupportedType, "coption of a variable sized type")
+		}
+		if isNil(value) {
+			return append(buf, make([]byte, 4+size)...), nil
+		}
+		return encodeValueWithDepth(binary.LittleEndian.AppendUint32(buf, 1), ctx, value, argType.COption, path, depth+1)
+	case argType.Defined != nil:
+		return encodeObjectWithDepth(buf, ctx, value, argType.Defined, path, depth+1)
+	}
+	return nil, newEncodeError(path, ErrUnsupportedType, "unsupported type %s", argType)
+}
+
+func encodeObjectWithDepth(buf []byte, ctx *encodeContext, value interface{}, defined *IdlTypeDefined, path string, depth int) ([]byte, error) {
+	if handler, ok := ctx.lookupType(defined.Name); ok {
+		if handler.Encode == nil {
+			return nil, newEncodeError(path, ErrUnsupportedType, "%s has no encoder", defined.Name)
+		}
+		b, err := handler.Encode(value)
+		if ee, ok := err.(*EncodeError); ok {
+			return nil, &EncodeError{Path: path, Reason: ee.Reason, Err: ee.Err}
+		}
+		if err != nil {
+			return nil, newEncodeError(path, ErrInvalidValue, "%v", err)
+		}
+		if handler.Size > 0 && len(b) != handler.Size {
+			return nil, newEncodeError(path, ErrInvalidValue, "%s encoded to %d bytes, expected %d", defined.Name, len(b), handler.Size)
+		}
+		return append(buf, b...), nil
+	}
+	typeData, err := ctx.resolve(defined)
+	if err != nil {
+		return nil, &EncodeError{Path: path, Err: err}
+	}
+	switch typeData.Kind {
+	case IdlTypeDefKindStruct:
+		return encodeFieldsWithDepth(buf, ctx, value, typeData.Fields, path, depth+1)
+	case IdlTypeDefKindEnum:
+		return encodeEnumWithDepth(buf, ctx, value, typeData, path, depth+1)
+	case IdlTypeDefKindType:
+		if typeData.Alias != nil {
+			return encodeValueWithDepth(buf, ctx, value, typeData.Alias, path, depth+1)
+		}
+	}
+	return nil, newEncodeError(path, ErrUnsupportedType, "that kind is not supported, kind: %s", typeData.Kind)
+}
+
+func encodeFieldsWithDepth(buf []byte, ctx *encodeContext, value interface{}, fields *IdlDefinedFields, path string, depth int) ([]byte, error) {
+	if fields == nil {
+		return buf, nil
+	}
+	if fields.IsTuple() {
+		items, err := toSlice(value, path)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) != len(fields.Tuple) {
+			return nil, newEncodeError(path, ErrInvalidValue, "expected %d tuple fields, got %d", len(fields.Tuple), len(items))
+		}
+		for i := range fields.Tuple {
+			buf, err = encodeValueWithDepth(buf, ctx, items[i], &fields.Tuple[i], fmt.Sprintf("%s[%d]", path, i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	getField, err := toFieldGetter(value, path)
+	if err != nil {
+		return nil, err
+	}
+	for i := range fields.Named {
+		field := &fields.Named[i]
+		fieldPath := joinPath(path, field.Name)
+		fieldValue, ok := getField(field.Name)
+		if !ok {
+			return nil, newEncodeError(fieldPath, ErrInvalidValue, "missing value")
+		}
+		buf, err = encodeValueWithDepth(buf, ctx, fieldValue, &field.Type, fieldPath, depth+1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// encodeEnumWithDepth accepts an *EnumValue, a variant name for unit
+// variants, or a single entry map of the form {"Variant": fields}.
+func encodeEnumWithDepth(buf []byte, ctx *encodeContext, value interface{}, typeData *IdlTypeDefTy, path string, depth int) ([]byte, error) {
+	var variantName string
+	var fields interface{}
+	switch v := value.(type) {
+	case *EnumValue:
+		variantName, fields = v.Variant, v.Fields
+	case EnumValue:
+		variantName, fields = v.Variant, v.Fields
+	case string:
+		variantName = v
+	case map[string]interface{}:
+		if len(v) != 1 {
+			return nil, newEncodeError(path, ErrInvalidValue, "enum value must have exactly one variant")
+		}
+		for k, f := range v {
+			variantName, fields = k, f
+		}
+	case *OrderedMap:
+		if v.Len() != 1 {
+			return nil, newEncodeError(path, ErrInvalidValue, "enum value must have exactly one variant")
+		}
+		variantName = v.Keys()[0]
+		fields, _ = v.Get(variantName)
+	default:
+		return nil, newEncodeError(path, ErrInvalidValue, "cannot encode %T as enum", value)
+	}
+	for i := range typeData.Variants {
+		variant := &typeData.Variants[i]
+		if variant.Name != variantName {
+			continue
+		}
+		if i > math.MaxUint8 {
+			return nil, newEncodeError(path, ErrUnsupportedType, "variant index %d out of range", i)
+		}
+		buf = append(buf, byte(i))
+		if variant.Fields == nil || variant.Fields.Len() == 0 {
+			return buf, nil
+		}
+		return encodeFieldsWithDepth(buf, ctx, fields, variant.Fields, joinPath(path, variantName), depth+1)
+	}
+	return nil, newEncodeError(path, ErrInvalidValue, "unknown enum variant %s", variantName)
+}
+
+func encodePrimitive(buf []byte, value interface{}, argType string, path string) ([]byte, error) {
+	switch argType {
+	case "bool":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, newEncodeError(path, ErrInvalidValue, "cannot encode %T as bool", value)
+		}
+		if b {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case "u8", "u16", "u32", "u64", "u128", "u256", "i8", "i16", "i32", "i64", "i128", "i256":
+		n, err := toBigInt(value)
+		if err != nil {
+			return nil, newEncodeError(path, ErrInvalidValue, "%v", err)
+		}
+		return appendInteger(buf, n, primitiveSizes[argType], argType[0] == 'i', path)
+	case "f32":
+		f, err := toFloat(value)
+		if err != nil {
+			return nil, newEncodeError(path, ErrInvalidValue, "%v", err)
+		}
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(f))), nil
+	case "f64":
+		f, err := toFloat(value)
+		if err != nil {
+			return nil, newEncodeError(path, ErrInvalidValue, "%v", err)
+		}
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f)), nil
+	case "pubkey", "publicKey":
+		key, err := toPubkey(value)
+		if err != nil {
+			return nil, newEncodeError(path, ErrInvalidValue, "%v", err)
+		}
+		return append(buf, key...), nil
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return nil, newEncodeError(path, ErrInvalidValue, "cannot encode %T as string", value)
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(s)))
+		return append(buf, s...), nil
+	case "bytes":
+		b, err := toBytes(value)
+		if err != nil {
+			return nil, newEncodeError(path, ErrInvalidValue, "%v", err)
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(b)))
+		return append(buf, b...), nil
+	}
+	if handler, ok := lookupPrimitive(argType); ok && handler.Encode != nil {
+		b, err := handler.Encode(value)
+		if ee, ok := err.(*EncodeError); ok {
+			return nil, &EncodeError{Path: path, Reason: ee.Reason, Err: ee.Err}
+		}
+		if err != nil {
+			return nil, newEncodeError(path, ErrInvalidValue, "%v", err)
+		}
+		if len(b) != handler.Size {
+			return nil, newEncodeError(path, ErrInvalidValue, "%s encoded to %d bytes, expected %d", argType, len(b), handler.Size)
+		}
+		return append(buf, b...), nil
+	}
+	return nil, newEncodeError(path, ErrUnsupportedType, "unsupported primitive %s", argType)
+}
+
+// appendInteger writes n as a size byte little-endian two's complement
+// integer after checking it fits.
+func appendInteger(buf []byte, n *big.Int, size int, signed bool, path string) ([]byte, error) {
+	bits := uint(size * 8)
+	lo, hi := new(big.Int), new(big.Int).Lsh(big.NewInt(1), bits)
+	if signed {
+		hi.Rsh(hi, 1)
+		lo.Neg(hi)
+	}
+	hi.Sub(hi, big.NewInt(1))
+	if n.Cmp(lo) < 0 || n.Cmp(hi) > 0 {
+		return nil, newEncodeError(path, ErrInvalidValue, "%s out of range [%s, %s]", n, lo, hi)
+	}
+	u := new(big.Int).Set(n)
+	if u.Sign() < 0 {
+		u.Add(u, new(big.Int).Lsh(big.NewInt(1), bits))
+	}
+	b := u.FillBytes(make([]byte, size))
+	for i := len(b) - 1; i >= 0; i-- {
+		buf = append(buf, b[i])
+	}
+	return buf, nil
+}
+
+func toBigInt(value interface{}) (*big.Int, error) {
+	switch v := value.(type) {
+	case int:
+		return big.NewInt(int64(v)), nil
+	case int8:
+		return big.NewInt(int64(v)), nil
+	case int16:
+		return big.NewInt(int64(v)), nil
+	case int32:
+		return big.NewInt(int64(v)), nil
+	case int64:
+		return big.NewInt(v), nil
+	case uint:
+		return new(big.Int).SetUint64(uint64(v)), nil
+	case uint8:
+		return new(big.Int).SetUint64(uint64(v)), nil
+	case uint16:
+		return new(big.Int).SetUint64(uint64(v)), nil
+	case uint32:
+		return new(big.Int).SetUint64(uint64(v)), nil
+	case uint64:
+		return new(big.Int).SetUint64(v), nil
+	case float64:
+		if v != math.Trunc(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%v is not an integer", v)
+		}
+		n, _ := big.NewFloat(v).Int(nil)
+		return n, nil
+	case json.Number:
+		return toBigInt(string(v))
+	case string:
+		n, ok := parseInteger(v)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer %q", v)
+		}
+		return n, nil
+	case *big.Int:
+		if v == nil {
+			return nil, fmt.Errorf("nil integer")
+		}
+		return v, nil
+	case big.Int:
+		return &v, nil
+	}
+	return nil, fmt.Errorf("cannot encode %T as integer", value)
+}
+
+// parseInteger reads a decimal integer, or a hexadecimal one with an explicit
+// 0x prefix. Leading zeros do not make it octal.
+func parseInteger(s string) (*big.Int, bool) {
+	sign, digits := "", s
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		sign, digits = s[:1], s[1:]
+	}
+	if hex, ok := strings.CutPrefix(digits, "0x"); ok {
+		if strings.HasPrefix(hex, "-") || strings.HasPrefix(hex, "+") {
+			return nil, false
+		}
+		return new(big.Int).SetString(sign+hex, 16)
+	}
+	return new(big.Int).SetString(s, 10)
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	n, err := toBigInt(value)
+	if err != nil {
+		return 0, fmt.Errorf("cannot encode %T as float", value)
+	}
+	f, _ := new(big.Float).SetInt(n).Float64()
+	return f, nil
+}
+
+func toPubkey(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		key := base58.Decode(v)
+		if len(key) != 32 {
+			return nil, fmt.Errorf("invalid pubkey %q", v)
+		}
+		return key, nil
+	case [32]byte:
+		return v[:], nil
+	case []byte:
+		if len(v) != 32 {
+			return nil, fmt.Errorf("invalid pubkey length %d", len(v))
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("cannot encode %T as pubkey", value)
+}
+
+func toBytes(value interface{}) ([]byte, error) {
+	if b, ok := value.([]byte); ok {
+		return b, nil
+	}
+	items, err := toSlice(value, "")
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode %T as bytes", value)
+	}
+	b := make([]byte, 0, len(items))
+	for _, item := range items {
+		n, err := toBigInt(item)
+		if err != nil || !n.IsUint64() || n.Uint64() > math.MaxUint8 {
+			return nil, fmt.Errorf("invalid byte %v", item)
+		}
+		b = append(b, byte(n.Uint64()))
+	}
+	return b, nil
+}
+
+func toSlice(value interface{}, path string) ([]interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, nil
+	case []byte:
+		return bytesToValues(v), nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, newEncodeError(path, ErrInvalidValue, "cannot encode %T as a sequence", value)
+	}
+	res := make([]interface{}, rv.Len())
+	for i := range res {
+		res[i] = rv.Index(i).Interface()
+	}
+	return res, nil
+}
+
+// toFieldGetter accepts the struct shapes produced by the decoder as well as
+// plain maps.
+func toFieldGetter(value interface{}, path string) (func(string) (interface{}, bool), error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return func(name string) (interface{}, bool) {
+			val, ok := v[name]
+			return val, ok
+		}, nil
+	case *OrderedMap:
+		return v.Get, nil
+	case nil:
+		return func(string) (interface{}, bool) { return nil, false }, nil
+	}
+	return nil, newEncodeError(path, ErrInvalidValue, "cannot encode %T as struct", value)
+}
+
+func isNil(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
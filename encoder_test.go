@@ -0,0 +1,303 @@
+package anchor_idl_parser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const roundTripTypes = `
+    {"name": "Pair", "type": {"kind": "struct", "fields": ["u8", "i16"]}},
+    {"name": "Side", "type": {"kind": "enum", "variants": [
+      {"name": "Bid"}, {"name": "Ask", "fields": ["u8", "bool"]}, {"name": "Limit", "fields": [{"name": "price", "type": "u64"}]}
+    ]}},
+    {"name": "Vault", "type": {"kind": "struct", "fields": [
+      {"name": "owner", "type": "pubkey"}, {"name": "amount", "type": "u64"}, {"name": "bump", "type": "u8"}
+    ]}},
+    {"name": "Swapped", "type": {"kind": "struct", "fields": [
+      {"name": "amount", "type": "u64"}, {"name": "side", "type": {"defined": {"name": "Side"}}}, {"name": "who", "type": "pubkey"}
+    ]}}`
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	const (
+		u128Max = "340282366920938463463374607431768211455"
+		i128Min = "-170141183460469231731687303715884105728"
+		i128Max = "170141183460469231731687303715884105727"
+		u256Max = "115792089237316195423570985008687907853269984665640564039457584007913129639935"
+		i256Min = "-57896044618658097711785492504343953926634992332820282019728792003956564819968"
+		i256Max = "57896044618658097711785492504343953926634992332820282019728792003956564819967"
+		pubkey  = "SeedPubey1111111111111111111111111111111111"
+	)
+	ones := func(n int) []byte { return bytes.Repeat([]byte{0xff}, n) }
+	tests := []struct {
+		argType string
+		value   interface{}
+		// data is the expected Borsh encoding, when pinned
+		data []byte
+	}{
+		{`"u8"`, uint8(255), []byte{255}},
+		{`"i8"`, int8(-128), []byte{0x80}},
+		{`"u16"`, uint16(65535), ones(2)},
+		{`"i16"`, int16(-32768), []byte{0, 0x80}},
+		{`"u32"`, uint32(1<<32 - 1), ones(4)},
+		{`"i32"`, int32(-1 << 31), []byte{0, 0, 0, 0x80}},
+		{`"u64"`, uint64(1<<64 - 1), ones(8)},
+		{`"i64"`, int64(-1 << 63), []byte{0, 0, 0, 0, 0, 0, 0, 0x80}},
+		{`"u128"`, "0", make([]byte, 16)},
+		{`"u128"`, u128Max, ones(16)},
+		{`"i128"`, i128Min, append(make([]byte, 15), 0x80)},
+		{`"i128"`, i128Max, append(ones(15), 0x7f)},
+		{`"i128"`, "-1", ones(16)},
+		{`"u256"`, u256Max, ones(32)},
+		{`"i256"`, i256Min, append(make([]byte, 31), 0x80)},
+		{`"i256"`, i256Max, append(ones(31), 0x7f)},
+		{`"f32"`, float32(1.5), []byte{0, 0, 0xc0, 0x3f}},
+		{`"f64"`, float64(-2.25), nil},
+		{`"bool"`, true, []byte{1}},
+		{`"string"`, "héllo", []byte{6, 0, 0, 0, 'h', 0xc3, 0xa9, 'l', 'l', 'o'}},
+		{`"pubkey"`, pubkey, nil},
+		{`"bytes"`, []byte{1, 2, 3}, []byte{3, 0, 0, 0, 1, 2, 3}},
+		{`{"vec": "u16"}`, []interface{}{uint16(1), uint16(2)}, []byte{2, 0, 0, 0, 1, 0, 2, 0}},
+		{`{"array": ["i8", 3]}`, []interface{}{int8(-1), int8(0), int8(1)}, []byte{0xff, 0, 1}},
+		{`{"option": "u64"}`, uint64(5), []byte{1, 5, 0, 0, 0, 0, 0, 0, 0}},
+		{`{"option": "u64"}`, nil, []byte{0}},
+		{`{"coption": "u32"}`, uint32(7), []byte{1, 0, 0, 0, 7, 0, 0, 0}},
+		{`{"coption": "u32"}`, nil, make([]byte, 8)},
+		{`{"defined": {"name": "Pair"}}`, []interface{}{uint8(1), int16(-2)}, []byte{1, 0xfe, 0xff}},
+		{`{"defined": {"name": "Side"}}`, &EnumValue{Variant: "Bid"}, []byte{0}},
+		{`{"defined": {"name": "Side"}}`, &EnumValue{Variant: "Ask", Fields: []interface{}{uint8(3), true}}, []byte{1, 3, 1}},
+		{`{"defined": {"name": "Side"}}`, &EnumValue{Variant: "Limit", Fields: map[string]interface{}{"price": uint64(9)}}, []byte{2, 9, 0, 0, 0, 0, 0, 0, 0}},
+		{`{"option": {"vec": {"defined": {"name": "Pair"}}}}`, []interface{}{[]interface{}{uint8(2), int16(3)}}, []byte{1, 1, 0, 0, 0, 2, 3, 0}},
+	}
+
+	instructions := make([]string, len(tests))
+	for i, tt := range tests {
+		instructions[i] = fmt.Sprintf(`{"name": "t%d", "discriminator": [%d, 0, 0, 0, 0, 0, 0, 0], "accounts": [], "args": [{"name": "v", "type": %s}]}`, i, i, tt.argType)
+	}
+	p, err := NewParserWithJson(`{
+  "address": "Trip111111111111111111111111111111111111111",
+  "metadata": {"name": "round_trip", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [` + strings.Join(instructions, ",") + `],
+  "types": [` + roundTripTypes + `]
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetStrict(true)
+	for i, tt := range tests {
+		name := fmt.Sprintf("t%d", i)
+		data, err := p.InstructionEncode(name, map[string]interface{}{"v": tt.value})
+		if err != nil {
+			t.Errorf("%s %v: %v", tt.argType, tt.value, err)
+			continue
+		}
+		if tt.data != nil && !bytes.Equal(data[8:], tt.data) {
+			t.Errorf("%s %v: encoded %v, want %v", tt.argType, tt.value, data[8:], tt.data)
+		}
+		res, err := p.InstructionParse(data)
+		if err != nil {
+			t.Errorf("%s %v: %v", tt.argType, tt.value, err)
+			continue
+		}
+		got := plainValue(res["data"].(map[string]interface{})["v"])
+		if want := plainValue(tt.value); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: decoded %#v, want %#v", tt.argType, got, want)
+		}
+	}
+}
+
+func TestEncodeOutOfRange(t *testing.T) {
+	p, err := NewParserWithJson(`{
+  "address": "Trip111111111111111111111111111111111111111",
+  "metadata": {"name": "round_trip", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "u128", "discriminator": [1], "accounts": [], "args": [{"name": "v", "type": "u128"}]},
+    {"name": "i256", "discriminator": [2], "accounts": [], "args": [{"name": "v", "type": "i256"}]},
+    {"name": "u8", "discriminator": [3], "accounts": [], "args": [{"name": "v", "type": "u8"}]}
+  ]
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"u128", "340282366920938463463374607431768211456"},
+		{"u128", "-1"},
+		{"i256", "57896044618658097711785492504343953926634992332820282019728792003956564819968"},
+		{"u8", 256},
+	} {
+		if _, err := p.InstructionEncode(tt.name, map[string]interface{}{"v": tt.value}); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("%s %v: got %v, want ErrInvalidValue", tt.name, tt.value, err)
+		}
+	}
+}
+
+const roundTripIdl = `{
+  "address": "Trip111111111111111111111111111111111111111",
+  "metadata": {"name": "round_trip", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [],
+  "accounts": [{"name": "Vault", "discriminator": [1, 1, 1, 1, 1, 1, 1, 1]}],
+  "events": [{"name": "Swapped", "discriminator": [2, 2, 2, 2, 2, 2, 2, 2]}],
+  "types": [` + roundTripTypes + `]
+}`
+
+func TestAccountsEncodeWithSpace(t *testing.T) {
+	p, err := NewParserWithJson(roundTripIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetStrict(true)
+	vault := map[string]interface{}{"owner": "SeedPubey1111111111111111111111111111111111", "amount": uint64(10), "bump": uint8(254)}
+
+	data, err := p.AccountsEncodeWithSpace("Vault", vault, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 8+32+8+1 {
+		t.Errorf("got %d bytes, want 49", len(data))
+	}
+	res, err := p.AccountsParse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := plainValue(res["data"]); !reflect.DeepEqual(got, vault) {
+		t.Errorf("decoded %v, want %v", got, vault)
+	}
+
+	padded, err := p.AccountsEncodeWithSpace("Vault", vault, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(padded) != 100 || !bytes.Equal(padded[:49], data) || !bytes.Equal(padded[49:], make([]byte, 51)) {
+		t.Errorf("got %v", padded)
+	}
+	if _, err := p.AccountsParse(padded); !errors.Is(err, ErrTrailingData) {
+		t.Errorf("got %v, want ErrTrailingData", err)
+	}
+	p.SetAllowAccountPadding(true)
+	if _, err := p.AccountsParse(padded); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := p.AccountsEncodeWithSpace("Vault", vault, 48); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("got %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestEventRoundTrip(t *testing.T) {
+	p, err := NewParserWithJson(roundTripIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetStrict(true)
+	event := map[string]interface{}{
+		"amount": uint64(42),
+		"side":   &EnumValue{Variant: "Ask", Fields: []interface{}{uint8(1), false}},
+		"who":    "SeedPubey1111111111111111111111111111111111",
+	}
+
+	line, err := p.EventLogEncode("Swapped", event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "Program data: "))
+	if err != nil || !bytes.Equal(data[:8], []byte{2, 2, 2, 2, 2, 2, 2, 2}) {
+		t.Fatalf("got %q %v", line, err)
+	}
+	res, err := p.EventParse(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["name"] != "Swapped" || !reflect.DeepEqual(plainValue(res["data"]), plainValue(event)) {
+		t.Errorf("got %v", res)
+	}
+
+	// emit_cpi! prefixes the event with sha256("anchor:event")[:8] reversed
+	cpi, err := p.EventCpiEncode("Swapped", event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := []byte{0xe4, 0x45, 0xa5, 0x2e, 0x51, 0xcb, 0x9a, 0x1d}
+	if !bytes.Equal(cpi[:8], prefix) || !bytes.Equal(cpi[8:], data) {
+		t.Errorf("got %v", cpi)
+	}
+	res, err = p.InstructionParse(cpi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["name"] != "Swapped" || res["type"] != ItemKindEvent || !reflect.DeepEqual(plainValue(res["data"]), plainValue(event)) {
+		t.Errorf("got %v", res)
+	}
+}
+
+func TestEncodeIntegerStrings(t *testing.T) {
+	p, err := NewParserWithJson(`{
+  "address": "Trip111111111111111111111111111111111111111",
+  "metadata": {"name": "round_trip", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "u64", "discriminator": [1], "accounts": [], "args": [{"name": "v", "type": "u64"}]},
+    {"name": "i128", "discriminator": [2], "accounts": [], "args": [{"name": "v", "type": "i128"}]}
+  ]
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name  string
+		value string
+		want  interface{}
+	}{
+		{"u64", "010", uint64(10)},
+		{"u64", "+007", uint64(7)},
+		{"u64", "0x10", uint64(16)},
+		{"i128", "-0010", "-10"},
+		{"i128", "-0xff", "-255"},
+	} {
+		data, err := p.InstructionEncode(tt.name, map[string]interface{}{"v": tt.value})
+		if err != nil {
+			t.Errorf("%s %q: %v", tt.name, tt.value, err)
+			continue
+		}
+		res, err := p.InstructionParse(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res["data"].(map[string]interface{})["v"]; got != tt.want {
+			t.Errorf("%s %q: got %v, want %v", tt.name, tt.value, got, tt.want)
+		}
+	}
+	for _, value := range []string{"0b1", "0o7", "1_000", "0x-1", "", "1.5"} {
+		if _, err := p.InstructionEncode("u64", map[string]interface{}{"v": value}); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("%q: got %v, want ErrInvalidValue", value, err)
+		}
+	}
+}
+
+// plainValue converts decoded ordered maps to plain maps for comparison.
+func plainValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case *OrderedMap:
+		return plainValue(v.Map())
+	case *EnumValue:
+		return &EnumValue{Variant: v.Variant, Fields: plainValue(v.Fields)}
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			res[key] = plainValue(item)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			res[i] = plainValue(item)
+		}
+		return res
+	}
+	return val
+}
@@ -0,0 +1,123 @@
+package anchor_idl_parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidIdl           = errors.New("invalid IDL")
+	ErrUnknownDiscriminator = errors.New("unknown discriminator")
+	ErrTruncatedData        = errors.New("truncated data")
+	ErrInvalidData          = errors.New("invalid data")
+	ErrTrailingData         = errors.New("trailing data")
+	ErrTypeNotFound         = errors.New("type not found")
+	ErrUnsupportedType      = errors.New("unsupported type")
+	ErrMaxDepthExceeded     = errors.New("max recursive depth exceeded")
+	ErrInvalidLog           = errors.New("invalid log")
+	ErrInstructionNotFound  = errors.New("instruction not found")
+	ErrAccountNotFound      = errors.New("account not found")
+	ErrEventNotFound        = errors.New("event not found")
+	ErrMissingAccounts      = errors.New("missing instruction accounts")
+	ErrInvalidValue         = errors.New("invalid value")
+	ErrProgramNotFound      = errors.New("program not found")
+)
+
+const (
+	ItemKindInstruction = "instruction"
+	ItemKindAccount     = "account"
+	ItemKindEvent       = "event"
+)
+
+// DecodeError describes where decoding of an instruction, account or event
+// failed. Err is one of the package sentinel errors, so errors.Is can be used
+// to tell, for example, an unknown discriminator from truncated data.
+type DecodeError struct {
+	Kind          string
+	Name          string
+	Discriminator []byte
+	// Path is the field path, e.g. args.params.routes[2].amount.
+	Path string
+	// Offset is the byte offset into the data passed to the parser.
+	Offset int
+	Reason string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("decode ")
+	sb.WriteString(e.Kind)
+	if e.Name != "" {
+		sb.WriteString(" ")
+		sb.WriteString(e.Name)
+	}
+	if e.Path != "" {
+		sb.WriteString(" at ")
+		sb.WriteString(e.Path)
+	}
+	sb.WriteString(" (offset ")
+	sb.WriteString(strconv.Itoa(e.Offset))
+	sb.WriteString("): ")
+	sb.WriteString(e.Err.Error())
+	if e.Reason != "" {
+		sb.WriteString(": ")
+		sb.WriteString(e.Reason)
+	}
+	return sb.String()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeError describes which value could not be encoded.
+type EncodeError struct {
+	Path   string
+	Reason string
+	Err    error
+}
+
+func (e *EncodeError) Error() string {
+	msg := e.Err.Error()
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	if e.Path == "" {
+		return "encode: " + msg
+	}
+	return "encode " + e.Path + ": " + msg
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+func newEncodeError(path string, err error, format string, args ...interface{}) *EncodeError {
+	return &EncodeError{Path: path, Reason: fmt.Sprintf(format, args...), Err: err}
+}
+
+// pathSegment is a struct field or arg name, or an index when name is empty.
+type pathSegment struct {
+	name  string
+	index int
+}
+
+func formatPath(segments []pathSegment) string {
+	var sb strings.Builder
+	for _, seg := range segments {
+		if seg.name == "" {
+			sb.WriteByte('[')
+			sb.WriteString(strconv.Itoa(seg.index))
+			sb.WriteByte(']')
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(seg.name)
+	}
+	return sb.String()
+}
@@ -0,0 +1,94 @@
+package anchor_idl_parser
+
+import (
+	"errors"
+	"testing"
+)
+
+const decodeErrorIdl = `{
+  "address": "Derr111111111111111111111111111111111111111",
+  "metadata": {"name": "decode_error", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "route", "discriminator": [1], "accounts": [],
+     "args": [{"name": "params", "type": {"defined": {"name": "Params"}}}]}
+  ],
+  "accounts": [{"name": "Pool", "discriminator": [2, 2]}],
+  "types": [
+    {"name": "Params", "type": {"kind": "struct", "fields": [
+      {"name": "fee", "type": "u16"},
+      {"name": "routes", "type": {"vec": {"defined": {"name": "Route"}}}}]}},
+    {"name": "Route", "type": {"kind": "struct", "fields": [
+      {"name": "pool", "type": "u8"},
+      {"name": "amount", "type": "u64"},
+      {"name": "hook", "type": {"option": {"defined": {"name": "Hook"}}}}]}},
+    {"name": "Hook", "type": {"kind": "struct", "fields": [
+      {"name": "memo", "type": {"coption": "string"}}]}},
+    {"name": "Pool", "type": {"kind": "struct", "fields": [
+      {"name": "routes", "type": {"array": [{"defined": {"name": "Route"}}, 2]}}]}}
+  ]
+}`
+
+func TestDecodeErrorPath(t *testing.T) {
+	p, err := NewParserWithJson(decodeErrorIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetStrict(true)
+	tests := []struct {
+		name   string
+		data   []byte
+		kind   string
+		target error
+		path   string
+		offset int
+	}{
+		{
+			name: "unsupported instruction field",
+			// fee, 2 routes, the second one with a hook
+			data:   []byte{1, 5, 0, 2, 0, 0, 0, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 2, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0},
+			kind:   ItemKindInstruction,
+			target: ErrUnsupportedType,
+			path:   "args.params.routes[1].hook.memo",
+			offset: 27,
+		},
+		{
+			name:   "truncated instruction field",
+			data:   []byte{1, 5, 0, 2, 0, 0, 0, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 2, 1, 0, 0},
+			kind:   ItemKindInstruction,
+			target: ErrTruncatedData,
+			path:   "args.params.routes[1].amount",
+			offset: 18,
+		},
+		{
+			name:   "truncated account field",
+			data:   []byte{2, 2, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 2},
+			kind:   ItemKindAccount,
+			target: ErrTruncatedData,
+			path:   "routes[1].amount",
+			offset: 13,
+		},
+	}
+	for _, tt := range tests {
+		var err error
+		if tt.kind == ItemKindInstruction {
+			_, err = p.InstructionParse(tt.data)
+		} else {
+			_, err = p.AccountsParse(tt.data)
+		}
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) || !errors.Is(err, tt.target) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.target)
+			continue
+		}
+		if decodeErr.Kind != tt.kind || decodeErr.Path != tt.path || decodeErr.Offset != tt.offset {
+			t.Errorf("%s: got %s %s at offset %d, want %s %s at offset %d",
+				tt.name, decodeErr.Kind, decodeErr.Path, decodeErr.Offset, tt.kind, tt.path, tt.offset)
+		}
+	}
+
+	_, err = p.InstructionParse([]byte{9, 0, 0, 0, 0, 0, 0, 0})
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || !errors.Is(err, ErrUnknownDiscriminator) || decodeErr.Path != "" {
+		t.Errorf("got %v, want ErrUnknownDiscriminator", err)
+	}
+}
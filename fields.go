@@ -1,263 +1,308 @@
 package anchor_idl_parser
 
 import (
-	"errors"
 	"fmt"
-	"log"
-	"strings"
 
 	"github.com/bytedance/sonic"
 )
 
 const maxRecursiveDepth = 62
 
-func extractArgs(data []byte, args []interface{}, types []interface{}) map[string]interface{} {
-	return extractArgsWithDepth(data, args, types, 0)
+// decodeContext carries the IDL and the parser options through a decode.
+type decodeContext struct {
+	*typeEnv
+	// legacyStrings restores the pre-structured output where vec and array
+	// values are comma joined strings and structs and enums are JSON strings.
+	legacyStrings bool
+	// strict reports truncated data, invalid bool, option and enum tags and,
+	// at the top level, trailing bytes instead of decoding them leniently.
+	strict bool
+
+	path []pathSegment
+	// err is the first failure, decoding keeps going so partial values are
+	// still available but the parse call reports it.
+	err *DecodeError
 }
 
-func extractArgsWithDepth(data []byte, args []interface{}, types []interface{}, depth int) map[string]interface{} {
-	argsValues := make(map[string]interface{})
-	offset := 0
-	for _, arg := range args {
-		argMap, ok := arg.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		argName, ok := argMap["name"].(string)
-		if !ok {
-			continue
-		}
-		argType := argMap["type"]
+func (ctx *decodeContext) pushField(name string) {
+	ctx.path = append(ctx.path, pathSegment{name: name})
+}
 
+func (ctx *decodeContext) pushIndex(index int) {
+	ctx.path = append(ctx.path, pathSegment{index: index})
+}
+
+func (ctx *decodeContext) pop() {
+	ctx.path = ctx.path[:len(ctx.path)-1]
+}
+
+// failStrict records a data error that lenient decoding tolerates.
+func (ctx *decodeContext) failStrict(offset int, err error, format string, args ...interface{}) {
+	if ctx.strict {
+		ctx.fail(offset, err, format, args...)
+	}
+}
+
+func (ctx *decodeContext) fail(offset int, err error, format string, args ...interface{}) {
+	if ctx.err != nil {
+		return
+	}
+	ctx.err = &DecodeError{
+		Path:   formatPath(ctx.path),
+		Offset: offset,
+		Reason: fmt.Sprintf(format, args...),
+		Err:    err,
+	}
+}
+
+func extractArgs(data []byte, args *fieldsPlan, ctx *decodeContext) (map[string]interface{}, int) {
+	return extractArgsWithDepth(data, args, ctx, 0)
+}
+
+func extractArgsWithDepth(data []byte, args *fieldsPlan, ctx *decodeContext, depth int) (map[string]interface{}, int) {
+	argsValues := make(map[string]interface{}, len(args.types))
+	offset := 0
+	for i, name := range args.names {
 		var n int
-		argsValues[argName], n = extractValueWithDepth(data, types, offset, argType, depth)
+		ctx.pushField(name)
+		argsValues[name], n = extractValueWithDepth(data, ctx, offset, args.types[i], depth)
+		ctx.pop()
 		offset += n
 	}
-	return argsValues
+	return argsValues, offset
 }
 
-func extractValue(data []byte, types []interface{}, offset int, argType interface{}) (interface{}, int) {
-	return extractValueWithDepth(data, types, offset, argType, 0)
+func extractValue(data []byte, ctx *decodeContext, offset int, plan *typePlan) (interface{}, int) {
+	return extractValueWithDepth(data, ctx, offset, plan, 0)
 }
 
-func extractValueWithDepth(data []byte, types []interface{}, offset int, argType interface{}, depth int) (interface{}, int) {
+func extractValueWithDepth(data []byte, ctx *decodeContext, offset int, plan *typePlan, depth int) (interface{}, int) {
 	if depth > maxRecursiveDepth {
+		ctx.fail(offset, ErrMaxDepthExceeded, "depth %d", depth)
 		return nil, 0
 	}
-	pType, ok := argType.(string)
-	if ok {
-		return extractPrimitive(data, offset, pType)
+	if primitive := plan.argType.Primitive; primitive != "" {
+		if !plan.builtin {
+			return extractCustomPrimitive(data, ctx, offset, primitive)
+		}
+		if primitive == "bool" && offset >= 0 && offset < len(data) && data[offset] > 1 {
+			ctx.failStrict(offset, ErrInvalidData, "invalid bool %d", data[offset])
+		}
+		val, n := extractPrimitive(data, offset, primitive)
+		if val == nil {
+			ctx.failStrict(offset, ErrTruncatedData, "%d bytes left for %s", max(len(data)-offset, 0), primitive)
+		}
+		if b, ok := val.([]byte); ok && ctx.legacyStrings {
+			return legacyJoin(bytesToValues(b)), n
+		}
+		return val, n
 	}
+	return extractNonPrimitiveWithDepth(data, ctx, offset, plan, depth+1)
+}
 
-	npType, ok := argType.(map[string]interface{})
-	if ok {
-		return extractNonPrimitiveWithDepth(data, types, offset, npType, depth+1)
+func extractCustomPrimitive(data []byte, ctx *decodeContext, offset int, name string) (interface{}, int) {
+	handler, ok := lookupPrimitive(name)
+	if !ok {
+		ctx.fail(offset, ErrUnsupportedType, "unknown primitive %s", name)
+		return nil, 0
 	}
-
-	return nil, 0
+	if offset < 0 || len(data)-offset < handler.Size {
+		ctx.failStrict(offset, ErrTruncatedData, "%d bytes left for %s", max(len(data)-offset, 0), name)
+		return nil, handler.Size
+	}
+	val, err := handler.Decode(data[offset : offset+handler.Size])
+	if err != nil {
+		ctx.fail(offset, ErrInvalidData, "%s: %v", name, err)
+		return nil, handler.Size
+	}
+	return val, handler.Size
 }
 
-func extractNonPrimitiveWithDepth(data []byte, types []interface{}, offset int, argType map[string]interface{}, depth int) (interface{}, int) {
+func extractNonPrimitiveWithDepth(data []byte, ctx *decodeContext, offset int, plan *typePlan, depth int) (interface{}, int) {
 	if depth > maxRecursiveDepth {
+		ctx.fail(offset, ErrMaxDepthExceeded, "depth %d", depth)
 		return nil, 0
 	}
-	vec, ok := argType["vec"]
-	if ok {
-		return extractVector(data, types, offset, vec)
-	}
-	arr, ok := argType["array"]
-	if ok {
-		return extractArray(data, types, offset, arr)
-	}
-	obj, ok := argType["defined"]
-	if ok {
-		value, ok := obj.(string)
-		if ok {
-			return extractObjectWithDepth(data, types, offset, value, depth+1)
-		} else {
-			value, ok := obj.(map[string]interface{})
-			if ok {
-				name, ok := value["name"]
-				if ok {
-					if value, ok := name.(string); ok {
-						return extractObjectWithDepth(data, types, offset, value, depth+1)
-					}
-				}
-			}
-		}
-	}
-	opt, ok := argType["option"]
-	if ok {
-		return extractValueWithDepth(data, types, offset, opt, depth+1)
+	argType := plan.argType
+	switch {
+	case argType.Vec != nil:
+		return extractVectorWithDepth(data, ctx, offset, plan.elem, depth+1)
+	case argType.Array != nil:
+		return extractArrayWithDepth(data, ctx, offset, argType.Array, plan.elem, depth+1)
+	case argType.Defined != nil:
+		return extractObjectWithDepth(data, ctx, offset, plan.defined, depth+1)
+	case argType.Option != nil:
+		return extractOptionWithDepth(data, ctx, offset, plan.elem, depth+1)
+	case argType.COption != nil:
+		return extractCOptionWithDepth(data, ctx, offset, plan, depth+1)
 	}
+	ctx.fail(offset, ErrUnsupportedType, "%s", argType)
 	return nil, 0
 }
 
-func extractObjectWithDepth(data []byte, types []interface{}, offset int, typeName string, depth int) (string, int) {
+func extractObjectWithDepth(data []byte, ctx *decodeContext, offset int, defined *definedPlan, depth int) (interface{}, int) {
 	if depth > maxRecursiveDepth {
-		return "", 0
+		ctx.fail(offset, ErrMaxDepthExceeded, "depth %d", depth)
+		return nil, 0
 	}
-	typeData, err := extractTypeData(types, typeName)
-	if err != nil {
-		return "", 0
+	if defined.handler != nil {
+		return extractCustomTypeWithDepth(data, ctx, offset, defined.name, *defined.handler)
+	}
+	if defined.err != nil {
+		ctx.fail(offset, defined.err, "")
+		return nil, 0
 	}
-	switch typeData["kind"] {
-	case "struct":
-		return extractStructWithDepth(data, types, offset, typeData, depth+1)
-	case "enum":
-		return extractEnumWithDepth(data, types, offset, typeData, depth+1)
+	var val interface{}
+	var n int
+	switch defined.kind {
+	case IdlTypeDefKindStruct:
+		val, n = extractStructWithDepth(data, ctx, offset, defined.fields, depth+1)
+	case IdlTypeDefKindEnum:
+		val, n = extractEnumWithDepth(data, ctx, offset, defined.variants, depth+1)
+	case IdlTypeDefKindType:
+		// an alias decodes exactly like its target type
+		if defined.alias == nil {
+			ctx.fail(offset, ErrUnsupportedType, "alias %s has no target", defined.name)
+			return nil, 0
+		}
+		return extractValueWithDepth(data, ctx, offset, defined.alias, depth+1)
 	default:
-		panic(fmt.Sprintf("that kind is not supported, kind: %s", typeData["kind"]))
+		ctx.fail(offset, ErrUnsupportedType, "that kind is not supported, kind: %s", defined.kind)
+		return nil, 0
+	}
+	if ctx.legacyStrings {
+		if val == nil {
+			return "", n
+		}
+		json, _ := sonic.Marshal(legacyPlain(val))
+		return string(json), n
 	}
+	return val, n
 }
 
-func extractStructWithDepth(data []byte, types []interface{}, offset int, typeData map[string]interface{}, depth int) (string, int) {
-	if depth > maxRecursiveDepth {
-		return "", 0
+func extractCustomTypeWithDepth(data []byte, ctx *decodeContext, offset int, name string, handler TypeHandler) (interface{}, int) {
+	if offset < 0 || offset > len(data) || (handler.Size > 0 && len(data)-offset < handler.Size) {
+		ctx.failStrict(offset, ErrTruncatedData, "%d bytes left for %s", max(len(data)-offset, 0), name)
+		return nil, handler.Size
 	}
-	fields, ok := typeData["fields"].([]interface{})
-	if !ok {
-		return "", 0
+	val, n, err := handler.Decode(data[offset:])
+	if err != nil {
+		ctx.fail(offset, ErrInvalidData, "%s: %v", name, err)
+		return nil, max(handler.Size, 0)
 	}
-	res := make(map[string]interface{})
-	var n int = 0
+	if n < 0 || n > len(data)-offset {
+		ctx.fail(offset, ErrInvalidData, "%s decoder consumed %d bytes", name, n)
+		return nil, 0
+	}
+	return val, n
+}
 
-	var n_i int
-	for _, field := range fields {
-		if tmpField, ok := field.(map[string]interface{}); ok {
-			fieldName, ok := tmpField["name"].(string)
-			if !ok {
-				continue
-			}
-			res[fieldName], n_i = extractValueWithDepth(data, types, offset+n, tmpField["type"], depth+1)
-			n += n_i
-		} else if tmpField, ok := field.(string); ok {
-			res[fmt.Sprintf("filed%d", n)], n_i = extractValueWithDepth(data, types, offset+n, tmpField, depth+1)
-			n += n_i
-		} else {
-			log.Println("cannot cast field to map[string]interface{},string in extractObject")
+// legacyPlain drops field ordering so legacy JSON strings keep their
+// original sorted key order.
+func legacyPlain(val interface{}) interface{} {
+	switch v := val.(type) {
+	case *OrderedMap:
+		return v.Map()
+	case *EnumValue:
+		if fields, ok := v.Fields.(*OrderedMap); ok {
+			return map[string]interface{}{v.Variant: fields.Map()}
 		}
-
+		if v.Fields == nil {
+			return map[string]interface{}{v.Variant: map[string]interface{}{}}
+		}
+		return map[string]interface{}{v.Variant: v.Fields}
 	}
+	return val
+}
 
-	json, _ := sonic.Marshal(res)
-	return string(json), n
+// extractStructWithDepth returns named structs as an *OrderedMap and tuple
+// structs as a positional []interface{}, like tuple enum variants.
+func extractStructWithDepth(data []byte, ctx *decodeContext, offset int, fields *fieldsPlan, depth int) (interface{}, int) {
+	if depth > maxRecursiveDepth {
+		ctx.fail(offset, ErrMaxDepthExceeded, "depth %d", depth)
+		return nil, 0
+	}
+	if fields == nil {
+		return NewOrderedMap(), 0
+	}
+	if fields.tuple {
+		return handleUnnamedFieldsWithDepth(data, ctx, offset, fields, depth+1)
+	}
+	return handleNamedFieldsWithDepth(data, ctx, offset, fields, depth+1)
 }
 
-func extractEnumWithDepth(data []byte, types []interface{}, offset int, typeData map[string]interface{}, depth int) (string, int) {
+func extractEnumWithDepth(data []byte, ctx *decodeContext, offset int, variants []variantPlan, depth int) (interface{}, int) {
 	if depth > maxRecursiveDepth {
-		return "", 0
+		ctx.fail(offset, ErrMaxDepthExceeded, "depth %d", depth)
+		return nil, 0
 	}
-	variants, ok := typeData["variants"].([]interface{})
-	if !ok {
-		return "", 0
+	if variants == nil {
+		return nil, 0
 	}
 	if offset >= len(data) {
-		return "", 0
+		ctx.failStrict(offset, ErrTruncatedData, "missing enum variant")
+		return nil, 0
 	}
 	variantId := data[offset]
 	if int(variantId) >= len(variants) {
-		return "", 0
-	}
-	variant, ok := variants[variantId].(map[string]interface{})
-	if !ok {
-		return "", 0
+		// the tag byte is still consumed so the next field stays aligned
+		ctx.failStrict(offset, ErrInvalidData, "enum variant %d out of range, %d variants", variantId, len(variants))
+		return nil, 1
 	}
-	memberName, ok := variant["name"].(string)
-	if !ok {
-		return "", 0
-	}
-	res := make(map[string]interface{})
+	variant := &variants[variantId]
+	res := &EnumValue{Variant: variant.name}
 
-	fields, ok := variant["fields"].([]interface{})
-	if !ok {
-		res[memberName] = make(map[string]interface{})
-		json, _ := sonic.Marshal(res)
-		return string(json), 1
+	if variant.fields == nil {
+		return res, 1
 	}
 
 	var n int = 1
+	var n_i int
 
-	_, ok = fields[0].(string)
-	if ok {
-		option, n_i := handleUnnamedEnumArgsWithDepth(data, types, offset+n, fields, depth+1)
-		n += n_i
-
-		res[memberName] = option
-		json, _ := sonic.Marshal(res)
-		return string(json), n
+	ctx.pushField(variant.name)
+	if variant.fields.tuple {
+		res.Fields, n_i = handleUnnamedFieldsWithDepth(data, ctx, offset+n, variant.fields, depth+1)
+	} else {
+		res.Fields, n_i = handleNamedFieldsWithDepth(data, ctx, offset+n, variant.fields, depth+1)
 	}
-
-	f1, ok := fields[0].(map[string]interface{})
-	_, hasName := f1["name"]
-	if ok && !hasName {
-		option, n_i := handleUnnamedEnumArgsWithDepth(data, types, offset+n, fields, depth+1)
-		n += n_i
-
-		res[memberName] = option
-		json, _ := sonic.Marshal(res)
-		return string(json), n
-	}
-
-	option, n_i := handleNamedEnumArgsWithDepth(data, types, offset+n, fields, depth+1)
+	ctx.pop()
 	n += n_i
 
-	res[memberName] = option
-	json, _ := sonic.Marshal(res)
-	return string(json), n
+	return res, n
 }
 
-func handleNamedEnumArgsWithDepth(data []byte, types []interface{}, offset int, fields []interface{}, depth int) (interface{}, int) {
+// handleNamedFieldsWithDepth decodes into an OrderedMap sharing the keys of
+// the plan, so only the values are allocated per decode.
+func handleNamedFieldsWithDepth(data []byte, ctx *decodeContext, offset int, fields *fieldsPlan, depth int) (interface{}, int) {
 	if depth > maxRecursiveDepth {
+		ctx.fail(offset, ErrMaxDepthExceeded, "depth %d", depth)
 		return nil, 0
 	}
 	n := 0
 	var n_i int
-	option := make(map[string]interface{})
-	for _, field := range fields {
-		obj, ok := field.(map[string]interface{})
-		if ok {
-			objName, ok := obj["name"].(string)
-			if ok {
-				option[objName], n_i = extractValueWithDepth(data, types, offset+n, obj["type"], depth+1)
-				n += n_i
-				continue
-			}
-		}
+	option := newPlannedOrderedMap(fields)
+	for i, name := range fields.names {
+		ctx.pushField(name)
+		option.values[fields.slots[i]], n_i = extractValueWithDepth(data, ctx, offset+n, fields.types[i], depth+1)
+		ctx.pop()
+		n += n_i
 	}
 	return option, n
 }
 
-func handleUnnamedEnumArgsWithDepth(data []byte, types []interface{}, offset int, fields []interface{}, depth int) (interface{}, int) {
+func handleUnnamedFieldsWithDepth(data []byte, ctx *decodeContext, offset int, fields *fieldsPlan, depth int) (interface{}, int) {
 	if depth > maxRecursiveDepth {
+		ctx.fail(offset, ErrMaxDepthExceeded, "depth %d", depth)
 		return nil, 0
 	}
 	n := 0
 	var n_i int
-	option := make([]interface{}, len(fields))
-	for i, field := range fields {
-		option[i], n_i = extractValueWithDepth(data, types, offset+n, field, depth+1)
+	option := make([]interface{}, len(fields.types))
+	for i := range fields.types {
+		ctx.pushIndex(i)
+		option[i], n_i = extractValueWithDepth(data, ctx, offset+n, fields.types[i], depth+1)
+		ctx.pop()
 		n += n_i
 	}
 	return option, n
 }
-
-func extractTypeData(types []interface{}, typeName string) (map[string]interface{}, error) {
-	for _, t := range types {
-		t, ok := t.(map[string]interface{})
-		if !ok {
-			return nil, errors.New("cannot cast type to map[string]interface{}")
-		}
-		tName, ok := t["name"].(string)
-		if ok {
-			if strings.EqualFold(tName, typeName) {
-				tType, ok := t["type"].(map[string]interface{})
-				if ok {
-					return tType, nil
-				}
-			}
-		}
-
-	}
-	return nil, fmt.Errorf("couldn't find type: %s, in: %+v", typeName, types)
-}
@@ -0,0 +1,119 @@
+package anchor_idl_parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bytedance/sonic"
+)
+
+const aliasIdl = `{
+  "address": "Alia111111111111111111111111111111111111111",
+  "metadata": {"name": "alias", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "pay", "discriminator": [1], "accounts": [], "args": [
+      {"name": "amount", "type": {"defined": {"name": "Amount"}}},
+      {"name": "splits", "type": {"defined": {"name": "Splits"}}}]},
+    {"name": "weird", "discriminator": [2, 0, 0, 0, 0, 0, 0, 0], "accounts": [], "args": [
+      {"name": "w", "type": {"defined": {"name": "Weird"}}}]}
+  ],
+  "accounts": [{"name": "Ledger", "discriminator": [3]}],
+  "types": [
+    {"name": "Amount", "type": {"kind": "type", "alias": "u64"}},
+    {"name": "Splits", "type": {"kind": "alias", "value": {"array": [{"defined": {"name": "Amount"}}, 2]}}},
+    {"name": "Weird", "type": {"kind": "union"}},
+    {"name": "Ledger", "type": {"kind": "struct", "fields": [
+      {"name": "total", "type": {"defined": {"name": "Amount"}}},
+      {"name": "splits", "type": {"defined": {"name": "Splits"}}}]}}
+  ]
+}`
+
+func TestExtractAlias(t *testing.T) {
+	p, err := NewParserWithJson(aliasIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the legacy form is read as a kind "type" alias
+	if splits := p.GetIdl().Types[1].Type; splits.Kind != IdlTypeDefKindType || splits.Alias == nil {
+		t.Errorf("got %+v", splits)
+	}
+
+	data := []byte{1, 5, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0}
+	res, err := p.InstructionParse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json, _ := sonic.Marshal(res["data"])
+	if want := `{"amount":5,"splits":[2,3]}`; string(json) != want {
+		t.Errorf("got %s, want %s", json, want)
+	}
+	encoded, err := p.InstructionEncode("pay", map[string]interface{}{"amount": uint64(5), "splits": []interface{}{uint64(2), uint64(3)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(encoded, data) {
+		t.Errorf("got %v, want %v", encoded, data)
+	}
+
+	if size, ok := p.AccountSize("Ledger"); !ok || size != 1+8+16 {
+		t.Errorf("got size %d %v, want 25", size, ok)
+	}
+}
+
+func TestExtractUnknownKind(t *testing.T) {
+	p, err := NewParserWithJson(aliasIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.InstructionParse([]byte{2, 0, 0, 0, 0, 0, 0, 0, 0})
+	var decodeErr *DecodeError
+	if !errors.Is(err, ErrUnsupportedType) || !errors.As(err, &decodeErr) {
+		t.Fatalf("got %v, want ErrUnsupportedType", err)
+	}
+	if _, err := p.InstructionEncode("weird", map[string]interface{}{"w": 0}); err == nil {
+		t.Error("encoded a type of unknown kind")
+	}
+}
+
+const tupleIdl = `{
+  "address": "Tupl111111111111111111111111111111111111111",
+  "metadata": {"name": "tuple", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "set", "discriminator": [1], "accounts": [], "args": [
+      {"name": "pair", "type": {"defined": {"name": "Pair"}}},
+      {"name": "unit", "type": {"defined": {"name": "Unit"}}},
+      {"name": "tail", "type": "u8"}]}
+  ],
+  "types": [
+    {"name": "Pair", "type": {"kind": "struct", "fields": [
+      "u8",
+      {"defined": {"name": "Point"}},
+      {"vec": "u16"},
+      {"option": {"defined": {"name": "Pair"}}}]}},
+    {"name": "Point", "type": {"kind": "struct", "fields": [
+      {"name": "x", "type": "i8"},
+      {"name": "y", "type": "i8"}]}},
+    {"name": "Unit", "type": {"kind": "struct"}}
+  ]
+}`
+
+func TestExtractTupleStruct(t *testing.T) {
+	p, err := NewParserWithJson(tupleIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pair(7, Point{-1, 2}, [3, 4], Some(Pair(8, Point{0, 0}, [], None)))
+	data := []byte{1, 7, 0xff, 2, 2, 0, 0, 0, 3, 0, 4, 0, 1, 8, 0, 0, 0, 0, 0, 0, 0, 9}
+	res, err := p.InstructionParse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json, _ := sonic.Marshal(res["data"])
+	if want := `{"pair":[7,{"x":-1,"y":2},[3,4],[8,{"x":0,"y":0},[],null]],"tail":9,"unit":{}}`; string(json) != want {
+		t.Errorf("got %s, want %s", json, want)
+	}
+	if _, ok := res["data"].(map[string]interface{})["pair"].([]interface{}); !ok {
+		t.Errorf("got %T, want []interface{}", res["data"].(map[string]interface{})["pair"])
+	}
+}
@@ -0,0 +1,182 @@
+package anchor_idl_parser
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	IdlGenericKindType  = "type"
+	IdlGenericKindConst = "const"
+)
+
+// genericEnv binds the generic parameters of a type definition to the
+// arguments of a defined reference.
+type genericEnv struct {
+	types  map[string]*IdlType
+	consts map[string]string
+}
+
+// ResolveDefined returns the definition a defined reference points to. For
+// generic definitions the returned copy has every {"generic": T} type and
+// const generic array length replaced by the reference's arguments.
+func (idl *Idl) ResolveDefined(defined *IdlTypeDefined) (*IdlTypeDefTy, error) {
+	return resolveTypeDef(idl.FindTypeDef(defined.Name), defined)
+}
+
+func resolveTypeDef(typeDef *IdlTypeDef, defined *IdlTypeDefined) (*IdlTypeDefTy, error) {
+	if typeDef == nil {
+		return nil, fmt.Errorf("%w: %s", ErrTypeNotFound, defined.Name)
+	}
+	if len(typeDef.Generics) == 0 {
+		return &typeDef.Type, nil
+	}
+	if len(defined.Generics) != len(typeDef.Generics) {
+		return nil, fmt.Errorf("%w: %s takes %d generic arguments, got %d", ErrInvalidIdl, defined.Name, len(typeDef.Generics), len(defined.Generics))
+	}
+	env := &genericEnv{
+		types:  make(map[string]*IdlType),
+		consts: make(map[string]string),
+	}
+	for i, param := range typeDef.Generics {
+		arg := &defined.Generics[i]
+		switch param.Kind {
+		case IdlGenericKindType:
+			if arg.Kind != IdlGenericKindType || arg.Type == nil {
+				return nil, fmt.Errorf("%w: %s generic %s expects a type argument", ErrInvalidIdl, defined.Name, param.Name)
+			}
+			env.types[param.Name] = arg.Type
+		case IdlGenericKindConst:
+			if arg.Kind != IdlGenericKindConst {
+				return nil, fmt.Errorf("%w: %s generic %s expects a const argument", ErrInvalidIdl, defined.Name, param.Name)
+			}
+			env.consts[param.Name] = arg.Value
+		default:
+			return nil, fmt.Errorf("%w: %s generic %s has kind %s", ErrUnsupportedType, defined.Name, param.Name, param.Kind)
+		}
+	}
+	return env.substituteTypeDefTy(&typeDef.Type)
+}
+
+func (env *genericEnv) substituteTypeDefTy(typeData *IdlTypeDefTy) (*IdlTypeDefTy, error) {
+	res := &IdlTypeDefTy{Kind: typeData.Kind}
+	var err error
+	if typeData.Fields != nil {
+		if res.Fields, err = env.substituteFields(typeData.Fields); err != nil {
+			return nil, err
+		}
+	}
+	if typeData.Variants != nil {
+		res.Variants = make([]IdlEnumVariant, len(typeData.Variants))
+		for i := range typeData.Variants {
+			res.Variants[i].Name = typeData.Variants[i].Name
+			if typeData.Variants[i].Fields == nil {
+				continue
+			}
+			if res.Variants[i].Fields, err = env.substituteFields(typeData.Variants[i].Fields); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if typeData.Alias != nil {
+		alias, err := env.substituteType(typeData.Alias)
+		if err != nil {
+			return nil, err
+		}
+		res.Alias = &alias
+	}
+	return res, nil
+}
+
+func (env *genericEnv) substituteFields(fields *IdlDefinedFields) (*IdlDefinedFields, error) {
+	res := &IdlDefinedFields{}
+	if fields.IsTuple() {
+		res.Tuple = make([]IdlType, len(fields.Tuple))
+		for i := range fields.Tuple {
+			t, err := env.substituteType(&fields.Tuple[i])
+			if err != nil {
+				return nil, err
+			}
+			res.Tuple[i] = t
+		}
+		return res, nil
+	}
+	res.Named = make([]IdlField, len(fields.Named))
+	for i := range fields.Named {
+		res.Named[i] = fields.Named[i]
+		t, err := env.substituteType(&fields.Named[i].Type)
+		if err != nil {
+			return nil, err
+		}
+		res.Named[i].Type = t
+	}
+	return res, nil
+}
+
+func (env *genericEnv) substituteType(argType *IdlType) (IdlType, error) {
+	switch {
+	case argType.Generic != "":
+		arg, ok := env.types[argType.Generic]
+		if !ok {
+			return IdlType{}, fmt.Errorf("%w: unbound generic %s", ErrInvalidIdl, argType.Generic)
+		}
+		return *arg, nil
+	case argType.Option != nil:
+		inner, err := env.substituteType(argType.Option)
+		return IdlType{Option: &inner}, err
+	case argType.COption != nil:
+		inner, err := env.substituteType(argType.COption)
+		return IdlType{COption: &inner}, err
+	case argType.Vec != nil:
+		inner, err := env.substituteType(argType.Vec)
+		return IdlType{Vec: &inner}, err
+	case argType.Array != nil:
+		elem, err := env.substituteType(&argType.Array.Elem)
+		if err != nil {
+			return IdlType{}, err
+		}
+		length := argType.Array.Len
+		if length.Generic != "" {
+			value, err := env.constValue(length.Generic)
+			if err != nil {
+				return IdlType{}, err
+			}
+			length = IdlArrayLen{Value: value}
+		}
+		return IdlType{Array: &IdlTypeArray{Elem: elem, Len: length}}, nil
+	case argType.Defined != nil:
+		defined := &IdlTypeDefined{Name: argType.Defined.Name}
+		for _, arg := range argType.Defined.Generics {
+			switch {
+			case arg.Type != nil && arg.Type.Generic != "" && env.types[arg.Type.Generic] == nil && env.consts[arg.Type.Generic] != "":
+				arg = IdlGenericArg{Kind: IdlGenericKindConst, Value: env.consts[arg.Type.Generic]}
+			case arg.Type != nil:
+				t, err := env.substituteType(arg.Type)
+				if err != nil {
+					return IdlType{}, err
+				}
+				arg.Type = &t
+			case arg.Kind == IdlGenericKindConst:
+				// a const argument may forward one of our own const generics
+				if value, ok := env.consts[arg.Value]; ok {
+					arg.Value = value
+				}
+			}
+			defined.Generics = append(defined.Generics, arg)
+		}
+		return IdlType{Defined: defined}, nil
+	}
+	return *argType, nil
+}
+
+func (env *genericEnv) constValue(name string) (int, error) {
+	raw, ok := env.consts[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: unbound const generic %s", ErrInvalidIdl, name)
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%w: const generic %s = %q is not a length", ErrInvalidIdl, name, raw)
+	}
+	return value, nil
+}
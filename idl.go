@@ -0,0 +1,563 @@
+package anchor_idl_parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// Idl is the typed form of an Anchor IDL. Both the 0.30+ spec and the legacy
+// (pre-0.30) layout are accepted; legacy account flags are folded into the
+// new-spec fields while unmarshalling. Parsers hold the IDL converted to the
+// new spec, see ConvertLegacyIdl.
+type Idl struct {
+	Address      string           `json:"address,omitempty"`
+	Name         string           `json:"name,omitempty"`
+	Version      string           `json:"version,omitempty"`
+	Metadata     IdlMetadata      `json:"metadata"`
+	Docs         []string         `json:"docs,omitempty"`
+	Instructions []IdlInstruction `json:"instructions"`
+	Accounts     []IdlAccount     `json:"accounts,omitempty"`
+	Events       []IdlEvent       `json:"events,omitempty"`
+	Errors       []IdlErrorCode   `json:"errors,omitempty"`
+	Types        []IdlTypeDef     `json:"types,omitempty"`
+	Constants    []IdlConst       `json:"constants,omitempty"`
+}
+
+type IdlMetadata struct {
+	Name         string          `json:"name,omitempty"`
+	Version      string          `json:"version,omitempty"`
+	Spec         string          `json:"spec,omitempty"`
+	Description  string          `json:"description,omitempty"`
+	Repository   string          `json:"repository,omitempty"`
+	Contact      string          `json:"contact,omitempty"`
+	Address      string          `json:"address,omitempty"`
+	Dependencies []IdlDependency `json:"dependencies,omitempty"`
+}
+
+type IdlDependency struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type IdlInstruction struct {
+	Name          string                      `json:"name"`
+	Docs          []string                    `json:"docs,omitempty"`
+	Discriminator IdlDiscriminator            `json:"discriminator,omitempty"`
+	Accounts      []IdlInstructionAccountItem `json:"accounts"`
+	Args          []IdlField                  `json:"args"`
+	Returns       *IdlType                    `json:"returns,omitempty"`
+}
+
+// IdlInstructionAccountItem is either a single account or, when Accounts is
+// non-nil, a composite group of accounts.
+type IdlInstructionAccountItem struct {
+	Name      string                      `json:"name"`
+	Docs      []string                    `json:"docs,omitempty"`
+	Writable  bool                        `json:"writable,omitempty"`
+	Signer    bool                        `json:"signer,omitempty"`
+	Optional  bool                        `json:"optional,omitempty"`
+	Address   string                      `json:"address,omitempty"`
+	Pda       *IdlPda                     `json:"pda,omitempty"`
+	Relations []string                    `json:"relations,omitempty"`
+	Accounts  []IdlInstructionAccountItem `json:"accounts,omitempty"`
+}
+
+func (a *IdlInstructionAccountItem) IsComposite() bool {
+	return a.Accounts != nil
+}
+
+func (a *IdlInstructionAccountItem) UnmarshalJSON(data []byte) error {
+	type plain IdlInstructionAccountItem
+	var raw struct {
+		plain
+		IsMut      *bool `json:"isMut"`
+		IsSigner   *bool `json:"isSigner"`
+		IsOptional *bool `json:"isOptional"`
+	}
+	if err := sonic.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*a = IdlInstructionAccountItem(raw.plain)
+	if raw.IsMut != nil {
+		a.Writable = a.Writable || *raw.IsMut
+	}
+	if raw.IsSigner != nil {
+		a.Signer = a.Signer || *raw.IsSigner
+	}
+	if raw.IsOptional != nil {
+		a.Optional = a.Optional || *raw.IsOptional
+	}
+	return nil
+}
+
+type IdlPda struct {
+	Seeds   []IdlSeed `json:"seeds"`
+	Program *IdlSeed  `json:"program,omitempty"`
+}
+
+// IdlSeed keeps Value loosely typed: the new spec stores const seeds as byte
+// arrays while legacy IDLs use strings and numbers.
+type IdlSeed struct {
+	Kind    string      `json:"kind"`
+	Type    *IdlType    `json:"type,omitempty"`
+	Value   interface{} `json:"value,omitempty"`
+	Path    string      `json:"path,omitempty"`
+	Account string      `json:"account,omitempty"`
+}
+
+type IdlAccount struct {
+	Name          string           `json:"name"`
+	Discriminator IdlDiscriminator `json:"discriminator,omitempty"`
+	// Type is only present in legacy IDLs, where the layout is inlined.
+	Type *IdlTypeDefTy `json:"type,omitempty"`
+}
+
+type IdlEvent struct {
+	Name          string           `json:"name"`
+	Discriminator IdlDiscriminator `json:"discriminator,omitempty"`
+	// Fields is only present in legacy IDLs, where the layout is inlined.
+	Fields []IdlField `json:"fields,omitempty"`
+}
+
+type IdlErrorCode struct {
+	Code uint32 `json:"code"`
+	Name string `json:"name"`
+	Msg  string `json:"msg,omitempty"`
+}
+
+type IdlConst struct {
+	Name  string   `json:"name"`
+	Docs  []string `json:"docs,omitempty"`
+	Type  IdlType  `json:"type"`
+	Value string   `json:"value"`
+}
+
+type IdlField struct {
+	Name  string   `json:"name"`
+	Docs  []string `json:"docs,omitempty"`
+	Type  IdlType  `json:"type"`
+	Index bool     `json:"index,omitempty"`
+}
+
+type IdlTypeDef struct {
+	Name          string              `json:"name"`
+	Docs          []string            `json:"docs,omitempty"`
+	Serialization string              `json:"serialization,omitempty"`
+	Repr          *IdlRepr            `json:"repr,omitempty"`
+	Generics      []IdlTypeDefGeneric `json:"generics,omitempty"`
+	Type          IdlTypeDefTy        `json:"type"`
+}
+
+type IdlRepr struct {
+	Kind   string `json:"kind"`
+	Packed bool   `json:"packed,omitempty"`
+	Align  *int   `json:"align,omitempty"`
+}
+
+type IdlTypeDefGeneric struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+const (
+	IdlTypeDefKindStruct = "struct"
+	IdlTypeDefKindEnum   = "enum"
+	IdlTypeDefKindType   = "type"
+)
+
+type IdlTypeDefTy struct {
+	Kind     string            `json:"kind"`
+	Fields   *IdlDefinedFields `json:"fields,omitempty"`
+	Variants []IdlEnumVariant  `json:"variants,omitempty"`
+	Alias    *IdlType          `json:"alias,omitempty"`
+}
+
+// UnmarshalJSON also accepts the legacy alias form {"kind": "alias",
+// "value": T}, stored as a kind "type" alias.
+func (t *IdlTypeDefTy) UnmarshalJSON(data []byte) error {
+	type plain IdlTypeDefTy
+	var raw struct {
+		plain
+		Value *IdlType `json:"value"`
+	}
+	if err := sonic.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*t = IdlTypeDefTy(raw.plain)
+	if t.Kind == "alias" && t.Alias == nil {
+		t.Kind = IdlTypeDefKindType
+		t.Alias = raw.Value
+	}
+	return nil
+}
+
+type IdlEnumVariant struct {
+	Name   string            `json:"name"`
+	Fields *IdlDefinedFields `json:"fields,omitempty"`
+}
+
+// IdlDefinedFields holds either named fields or tuple fields, never both.
+type IdlDefinedFields struct {
+	Named []IdlField
+	Tuple []IdlType
+}
+
+func (f *IdlDefinedFields) IsTuple() bool {
+	return f.Named == nil && f.Tuple != nil
+}
+
+func (f *IdlDefinedFields) Len() int {
+	if f.IsTuple() {
+		return len(f.Tuple)
+	}
+	return len(f.Named)
+}
+
+func (f *IdlDefinedFields) UnmarshalJSON(data []byte) error {
+	var items []json.RawMessage
+	if err := sonic.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		f.Named = []IdlField{}
+		return nil
+	}
+	var probe map[string]interface{}
+	if err := sonic.Unmarshal(items[0], &probe); err == nil {
+		if _, ok := probe["name"]; ok {
+			return sonic.Unmarshal(data, &f.Named)
+		}
+	}
+	return sonic.Unmarshal(data, &f.Tuple)
+}
+
+func (f IdlDefinedFields) MarshalJSON() ([]byte, error) {
+	if f.IsTuple() {
+		return sonic.Marshal(f.Tuple)
+	}
+	if f.Named == nil {
+		return []byte("[]"), nil
+	}
+	return sonic.Marshal(f.Named)
+}
+
+// IdlType is a type reference. Exactly one of its members is set.
+type IdlType struct {
+	Primitive string
+	Defined   *IdlTypeDefined
+	Option    *IdlType
+	COption   *IdlType
+	Vec       *IdlType
+	Array     *IdlTypeArray
+	Generic   string
+}
+
+type IdlTypeDefined struct {
+	Name     string          `json:"name"`
+	Generics []IdlGenericArg `json:"generics,omitempty"`
+}
+
+type IdlTypeArray struct {
+	Elem IdlType
+	Len  IdlArrayLen
+}
+
+// IdlArrayLen is either a literal length or the name of a const generic.
+type IdlArrayLen struct {
+	Value   int
+	Generic string
+}
+
+type IdlGenericArg struct {
+	Kind  string   `json:"kind"`
+	Type  *IdlType `json:"type,omitempty"`
+	Value string   `json:"value,omitempty"`
+}
+
+func (t *IdlType) UnmarshalJSON(data []byte) error {
+	var primitive string
+	if err := sonic.Unmarshal(data, &primitive); err == nil {
+		if primitive == "" {
+			return errors.New("empty type name")
+		}
+		*t = IdlType{Primitive: primitive}
+		return nil
+	}
+
+	var obj map[string]json.RawMessage
+	if err := sonic.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("invalid type: %s", string(data))
+	}
+	*t = IdlType{}
+	if raw, ok := obj["defined"]; ok {
+		var name string
+		if err := sonic.Unmarshal(raw, &name); err == nil {
+			t.Defined = &IdlTypeDefined{Name: name}
+			return nil
+		}
+		t.Defined = &IdlTypeDefined{}
+		return sonic.Unmarshal(raw, t.Defined)
+	}
+	if raw, ok := obj["option"]; ok {
+		t.Option = &IdlType{}
+		return sonic.Unmarshal(raw, t.Option)
+	}
+	if raw, ok := obj["coption"]; ok {
+		t.COption = &IdlType{}
+		return sonic.Unmarshal(raw, t.COption)
+	}
+	if raw, ok := obj["vec"]; ok {
+		t.Vec = &IdlType{}
+		return sonic.Unmarshal(raw, t.Vec)
+	}
+	if raw, ok := obj["array"]; ok {
+		var pair []json.RawMessage
+		if err := sonic.Unmarshal(raw, &pair); err != nil {
+			return err
+		}
+		if len(pair) != 2 {
+			return fmt.Errorf("invalid array type: %s", string(raw))
+		}
+		t.Array = &IdlTypeArray{}
+		if err := sonic.Unmarshal(pair[0], &t.Array.Elem); err != nil {
+			return err
+		}
+		return sonic.Unmarshal(pair[1], &t.Array.Len)
+	}
+	if raw, ok := obj["generic"]; ok {
+		return sonic.Unmarshal(raw, &t.Generic)
+	}
+	return fmt.Errorf("unsupported type: %s", string(data))
+}
+
+func (t IdlType) MarshalJSON() ([]byte, error) {
+	switch {
+	case t.Primitive != "":
+		return sonic.Marshal(t.Primitive)
+	case t.Defined != nil:
+		return sonic.Marshal(map[string]interface{}{"defined": t.Defined})
+	case t.Option != nil:
+		return sonic.Marshal(map[string]interface{}{"option": t.Option})
+	case t.COption != nil:
+		return sonic.Marshal(map[string]interface{}{"coption": t.COption})
+	case t.Vec != nil:
+		return sonic.Marshal(map[string]interface{}{"vec": t.Vec})
+	case t.Array != nil:
+		return sonic.Marshal(map[string]interface{}{"array": []interface{}{t.Array.Elem, t.Array.Len}})
+	case t.Generic != "":
+		return sonic.Marshal(map[string]interface{}{"generic": t.Generic})
+	}
+	return nil, errors.New("empty type")
+}
+
+func (t IdlType) String() string {
+	b, err := t.MarshalJSON()
+	if err != nil {
+		return "<invalid>"
+	}
+	return string(b)
+}
+
+func (l *IdlArrayLen) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := sonic.Unmarshal(data, &n); err == nil {
+		if n < 0 {
+			return fmt.Errorf("negative array length: %d", n)
+		}
+		*l = IdlArrayLen{Value: n}
+		return nil
+	}
+	var generic struct {
+		Generic string `json:"generic"`
+	}
+	if err := sonic.Unmarshal(data, &generic); err != nil || generic.Generic == "" {
+		return fmt.Errorf("invalid array length: %s", string(data))
+	}
+	*l = IdlArrayLen{Generic: generic.Generic}
+	return nil
+}
+
+func (l IdlArrayLen) MarshalJSON() ([]byte, error) {
+	if l.Generic != "" {
+		return sonic.Marshal(map[string]string{"generic": l.Generic})
+	}
+	return sonic.Marshal(l.Value)
+}
+
+// IdlDiscriminator is serialized as a JSON array of numbers rather than the
+// base64 string encoding/json would use for a []byte.
+type IdlDiscriminator []byte
+
+func (d *IdlDiscriminator) UnmarshalJSON(data []byte) error {
+	var values []int
+	if err := sonic.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("invalid discriminator: %s", string(data))
+	}
+	res := make(IdlDiscriminator, len(values))
+	for i, v := range values {
+		if v < 0 || v > 255 {
+			return fmt.Errorf("discriminator byte out of range: %d", v)
+		}
+		res[i] = byte(v)
+	}
+	*d = res
+	return nil
+}
+
+func (d IdlDiscriminator) MarshalJSON() ([]byte, error) {
+	values := make([]int, len(d))
+	for i, v := range d {
+		values[i] = int(v)
+	}
+	return sonic.Marshal(values)
+}
+
+// ProgramAddress returns the program id declared by the IDL, looking at the
+// top-level address first and falling back to the legacy metadata.address.
+func (idl *Idl) ProgramAddress() string {
+	if idl.Address != "" {
+		return idl.Address
+	}
+	return idl.Metadata.Address
+}
+
+// ProgramName returns the program name from metadata, or the legacy
+// top-level name.
+func (idl *Idl) ProgramName() string {
+	if idl.Metadata.Name != "" {
+		return idl.Metadata.Name
+	}
+	return idl.Name
+}
+
+// ProgramVersion returns the program version from metadata, or the legacy
+// top-level version.
+func (idl *Idl) ProgramVersion() string {
+	if idl.Metadata.Version != "" {
+		return idl.Metadata.Version
+	}
+	return idl.Version
+}
+
+func (idl *Idl) FindInstruction(name string) *IdlInstruction {
+	for i := range idl.Instructions {
+		if idl.Instructions[i].Name == name {
+			return &idl.Instructions[i]
+		}
+	}
+	return nil
+}
+
+func (idl *Idl) FindAccount(name string) *IdlAccount {
+	for i := range idl.Accounts {
+		if idl.Accounts[i].Name == name {
+			return &idl.Accounts[i]
+		}
+	}
+	return nil
+}
+
+func (idl *Idl) FindEvent(name string) *IdlEvent {
+	for i := range idl.Events {
+		if idl.Events[i].Name == name {
+			return &idl.Events[i]
+		}
+	}
+	return nil
+}
+
+// FindTypeDef looks a type definition up by name, ignoring case to match
+// IDLs that mix naming conventions between references and definitions.
+func (idl *Idl) FindTypeDef(name string) *IdlTypeDef {
+	for i := range idl.Types {
+		if idl.Types[i].Name == name {
+			return &idl.Types[i]
+		}
+	}
+	for i := range idl.Types {
+		if strings.EqualFold(idl.Types[i].Name, name) {
+			return &idl.Types[i]
+		}
+	}
+	return nil
+}
+
+// Validate checks the structural invariants the decoder relies on. Failures
+// wrap ErrInvalidIdl.
+func (idl *Idl) Validate() error {
+	if err := idl.validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdl, err)
+	}
+	return nil
+}
+
+func (idl *Idl) validate() error {
+	for i, ins := range idl.Instructions {
+		if ins.Name == "" {
+			return fmt.Errorf("instruction %d has no name", i)
+		}
+		for _, arg := range ins.Args {
+			if arg.Name == "" {
+				return fmt.Errorf("instruction %s has an unnamed arg", ins.Name)
+			}
+		}
+		if err := validateAccountItems(ins.Name, ins.Accounts); err != nil {
+			return err
+		}
+	}
+	for i, acc := range idl.Accounts {
+		if acc.Name == "" {
+			return fmt.Errorf("account %d has no name", i)
+		}
+	}
+	for i, ev := range idl.Events {
+		if ev.Name == "" {
+			return fmt.Errorf("event %d has no name", i)
+		}
+	}
+	for i, typeDef := range idl.Types {
+		if typeDef.Name == "" {
+			return fmt.Errorf("type %d has no name", i)
+		}
+		switch typeDef.Type.Kind {
+		case IdlTypeDefKindStruct:
+		case IdlTypeDefKindEnum:
+			for _, variant := range typeDef.Type.Variants {
+				if variant.Name == "" {
+					return fmt.Errorf("type %s has an unnamed variant", typeDef.Name)
+				}
+			}
+		case IdlTypeDefKindType:
+			if typeDef.Type.Alias == nil {
+				return fmt.Errorf("type %s is an alias without a target", typeDef.Name)
+			}
+		case "":
+			return fmt.Errorf("type %s has no kind", typeDef.Name)
+		}
+	}
+	for i, e := range idl.Errors {
+		if e.Name == "" {
+			return fmt.Errorf("error %d has no name", i)
+		}
+	}
+	return nil
+}
+
+func validateAccountItems(insName string, items []IdlInstructionAccountItem) error {
+	for _, item := range items {
+		if item.Name == "" {
+			return fmt.Errorf("instruction %s has an unnamed account", insName)
+		}
+		if item.IsComposite() {
+			if err := validateAccountItems(insName, item.Accounts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package anchor_idl_parser
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/heroims/anchor-idl-parser-go/utils"
+)
+
+const (
+	idlAccountSeed = "anchor:idl"
+	// maxIdlJsonSize bounds the decompressed IDL so a corrupt account cannot
+	// exhaust memory.
+	maxIdlJsonSize = 64 << 20
+)
+
+var idlAccountDiscriminator = func() []byte {
+	h := sha256.Sum256([]byte("account:IdlAccount"))
+	return h[:8]
+}()
+
+// OnChainIdl is the content of the IdlAccount Anchor publishes for a program.
+type OnChainIdl struct {
+	Authority string
+	IdlJson   string
+}
+
+// IdlAddress derives the address of the IdlAccount of the program, the
+// address `anchor idl init` writes to.
+func IdlAddress(programId string) (string, error) {
+	base, _, err := FindProgramAddress(nil, programId)
+	if err != nil {
+		return "", err
+	}
+	return CreateWithSeed(base, idlAccountSeed, programId)
+}
+
+// DecodeIdlAccount decodes the raw data of an IdlAccount: the account
+// discriminator, the authority, a u32 length and the zlib compressed IDL JSON.
+func DecodeIdlAccount(data []byte) (*OnChainIdl, error) {
+	const headerLen = 8 + 32 + 4
+	if len(data) < headerLen {
+		return nil, fmt.Errorf("%w: idl account is %d bytes, header needs %d", ErrTruncatedData, len(data), headerLen)
+	}
+	if !bytes.Equal(data[:8], idlAccountDiscriminator) {
+		return nil, fmt.Errorf("%w: not an idl account, discriminator %v", ErrUnknownDiscriminator, data[:8])
+	}
+	authority := utils.EncodeBase58(data[8:40])
+	dataLen := binary.LittleEndian.Uint32(data[40:headerLen])
+	if uint64(dataLen) > uint64(len(data)-headerLen) {
+		return nil, fmt.Errorf("%w: idl data is %d bytes, %d left", ErrTruncatedData, dataLen, len(data)-headerLen)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(data[headerLen : headerLen+int(dataLen)]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+	defer r.Close()
+	idlJson, err := io.ReadAll(io.LimitReader(r, maxIdlJsonSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+	if len(idlJson) > maxIdlJsonSize {
+		return nil, fmt.Errorf("%w: idl larger than %d bytes", ErrInvalidData, maxIdlJsonSize)
+	}
+	return &OnChainIdl{Authority: authority, IdlJson: string(idlJson)}, nil
+}
+
+// NewParserWithIdlAccount builds a parser from the raw data of a program's
+// IdlAccount, see IdlAddress for where to fetch it from.
+func NewParserWithIdlAccount(data []byte) (*Parser, error) {
+	onChain, err := DecodeIdlAccount(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewParserWithJson(onChain.IdlJson)
+}
@@ -0,0 +1,80 @@
+package anchor_idl_parser
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+const idlAccountIdl = `{
+  "address": "Idla111111111111111111111111111111111111111",
+  "metadata": {"name": "idl_account", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [{"name": "quote", "discriminator": [1], "accounts": [], "args": []}]
+}`
+
+func TestIdlAddress(t *testing.T) {
+	programId := "BPFLoaderUpgradeab1e11111111111111111111111"
+	// anchor idl init writes to create_with_seed(find_program_address([]),
+	// "anchor:idl", program)
+	base, _, err := FindProgramAddress(nil, programId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := CreateWithSeed(base, "anchor:idl", programId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := IdlAddress(programId); err != nil || got != want {
+		t.Errorf("got %s %v, want %s", got, err, want)
+	}
+}
+
+// idlAccountData lays an IdlAccount out like Anchor: the account
+// discriminator, the authority, the u32 length of the zlib compressed IDL and
+// the spare space the account was allocated with.
+func idlAccountData(t *testing.T, authority string, idlJson string) []byte {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write([]byte(idlJson))
+	w.Close()
+	key, err := toPubkey(authority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sha256("account:IdlAccount")[:8]
+	data := []byte{140, 36, 166, 2, 103, 197, 33, 164}
+	data = append(data, key...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(compressed.Len()))
+	data = append(data, compressed.Bytes()...)
+	return append(data, make([]byte, 64)...)
+}
+
+func TestDecodeIdlAccount(t *testing.T) {
+	authority := "SeedPubey1111111111111111111111111111111111"
+	data := idlAccountData(t, authority, idlAccountIdl)
+	res, err := DecodeIdlAccount(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Authority != authority || res.IdlJson != idlAccountIdl {
+		t.Errorf("got %s %q", res.Authority, res.IdlJson)
+	}
+	p, err := NewParserWithIdlAccount(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.idl.FindInstruction("quote") == nil {
+		t.Error("quote instruction missing")
+	}
+
+	if _, err := DecodeIdlAccount(data[:50]); !errors.Is(err, ErrTruncatedData) {
+		t.Errorf("got %v, want ErrTruncatedData", err)
+	}
+	bad := append([]byte{}, data...)
+	bad[0]++
+	if _, err := DecodeIdlAccount(bad); !errors.Is(err, ErrUnknownDiscriminator) {
+		t.Errorf("got %v, want ErrUnknownDiscriminator", err)
+	}
+}
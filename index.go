@@ -0,0 +1,131 @@
+package anchor_idl_parser
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// discriminatorIndex maps discriminators to item positions so dispatch is a
+// map lookup per distinct discriminator length rather than a scan of every
+// instruction, account or event.
+type discriminatorIndex struct {
+	// lengths holds the distinct discriminator lengths, longest first.
+	lengths []int
+	items   map[string]int
+}
+
+func newDiscriminatorIndex(items []namedDiscriminator) *discriminatorIndex {
+	ix := &discriminatorIndex{items: make(map[string]int, len(items))}
+	seen := make(map[int]bool)
+	for i, item := range items {
+		discriminator := item.discriminator
+		ix.items[string(discriminator)] = i
+		if !seen[len(discriminator)] {
+			seen[len(discriminator)] = true
+			ix.lengths = append(ix.lengths, len(discriminator))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ix.lengths)))
+	return ix
+}
+
+// lookup returns the position of the item whose discriminator prefixes data,
+// preferring the longest discriminator when several do.
+func (ix *discriminatorIndex) lookup(data []byte) (int, bool) {
+	for _, n := range ix.lengths {
+		if n > len(data) {
+			continue
+		}
+		if i, ok := ix.items[string(data[:n])]; ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (p *Parser) buildIndexes() error {
+	instructions := make([]namedDiscriminator, len(p.idl.Instructions))
+	for i := range p.idl.Instructions {
+		instructions[i] = namedDiscriminator{p.idl.Instructions[i].Name, p.idl.Instructions[i].Discriminator}
+	}
+	accounts := make([]namedDiscriminator, len(p.idl.Accounts))
+	for i := range p.idl.Accounts {
+		accounts[i] = namedDiscriminator{p.idl.Accounts[i].Name, p.idl.Accounts[i].Discriminator}
+	}
+	events := make([]namedDiscriminator, len(p.idl.Events))
+	for i := range p.idl.Events {
+		events[i] = namedDiscriminator{p.idl.Events[i].Name, p.idl.Events[i].Discriminator}
+	}
+
+	p.conflicts = nil
+	for _, group := range []struct {
+		kind  string
+		items []namedDiscriminator
+		index **discriminatorIndex
+	}{
+		{ItemKindInstruction, instructions, &p.instructionIndex},
+		{ItemKindAccount, accounts, &p.accountIndex},
+		{ItemKindEvent, events, &p.eventIndex},
+	} {
+		conflicts, err := checkDiscriminators(group.kind, group.items)
+		if err != nil {
+			return err
+		}
+		p.conflicts = append(p.conflicts, conflicts...)
+		*group.index = newDiscriminatorIndex(group.items)
+	}
+	return nil
+}
+
+// DiscriminatorConflict is a discriminator that is a prefix of another one
+// of the same item kind. Data starting with the longer discriminator is
+// dispatched to its item, so the shorter item can never be decoded from such
+// data.
+type DiscriminatorConflict struct {
+	Kind string
+	// Name is the item with the shorter discriminator, Other the item whose
+	// discriminator it prefixes.
+	Name               string
+	Other              string
+	Discriminator      IdlDiscriminator
+	OtherDiscriminator IdlDiscriminator
+}
+
+func (c DiscriminatorConflict) String() string {
+	return fmt.Sprintf("%s %s discriminator %v is a prefix of %s %v", c.Kind, c.Name, []byte(c.Discriminator), c.Other, []byte(c.OtherDiscriminator))
+}
+
+// DiscriminatorConflicts returns the discriminators found at load time that
+// are a prefix of another discriminator of the same kind.
+func (p *Parser) DiscriminatorConflicts() []DiscriminatorConflict {
+	return p.conflicts
+}
+
+type namedDiscriminator struct {
+	name          string
+	discriminator IdlDiscriminator
+}
+
+// checkDiscriminators rejects empty and duplicated discriminators, which
+// make items unreachable, and returns the prefix conflicts that the longest
+// match rule resolves.
+func checkDiscriminators(kind string, items []namedDiscriminator) ([]DiscriminatorConflict, error) {
+	var conflicts []DiscriminatorConflict
+	for i, item := range items {
+		if len(item.discriminator) == 0 {
+			return nil, fmt.Errorf("%w: %s %s has an empty discriminator", ErrInvalidIdl, kind, item.name)
+		}
+		for _, other := range items[:i] {
+			switch {
+			case bytes.Equal(item.discriminator, other.discriminator):
+				return nil, fmt.Errorf("%w: %s %s and %s share discriminator %v", ErrInvalidIdl, kind, other.name, item.name, []byte(item.discriminator))
+			case bytes.HasPrefix(other.discriminator, item.discriminator):
+				conflicts = append(conflicts, DiscriminatorConflict{Kind: kind, Name: item.name, Other: other.name, Discriminator: item.discriminator, OtherDiscriminator: other.discriminator})
+			case bytes.HasPrefix(item.discriminator, other.discriminator):
+				conflicts = append(conflicts, DiscriminatorConflict{Kind: kind, Name: other.name, Other: item.name, Discriminator: other.discriminator, OtherDiscriminator: item.discriminator})
+			}
+		}
+	}
+	return conflicts, nil
+}
@@ -0,0 +1,124 @@
+package anchor_idl_parser
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func indexIdl(instructions string, accounts string) string {
+	return `{
+  "address": "Indx111111111111111111111111111111111111111",
+  "metadata": {"name": "index", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [` + instructions + `],
+  "accounts": [` + accounts + `],
+  "types": [
+    {"name": "Short", "type": {"kind": "struct", "fields": [{"name": "a", "type": "u8"}]}},
+    {"name": "Long", "type": {"kind": "struct", "fields": [{"name": "b", "type": "u8"}]}}
+  ]
+}`
+}
+
+const overlappingInstructions = `
+    {"name": "short", "discriminator": [1, 2], "accounts": [], "args": [{"name": "a", "type": "u8"}]},
+    {"name": "long", "discriminator": [1, 2, 3, 4], "accounts": [], "args": [{"name": "b", "type": "u8"}]},
+    {"name": "other", "discriminator": [9], "accounts": [], "args": []}`
+
+const overlappingAccounts = `
+    {"name": "Long", "discriminator": [5, 6, 7]},
+    {"name": "Short", "discriminator": [5]}`
+
+func TestDiscriminatorLongestMatch(t *testing.T) {
+	p, err := NewParserWithJson(indexIdl(overlappingInstructions, overlappingAccounts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		data []byte
+		name string
+		args map[string]interface{}
+	}{
+		{[]byte{1, 2, 3, 4, 7}, "long", map[string]interface{}{"b": uint8(7)}},
+		{[]byte{1, 2, 9}, "short", map[string]interface{}{"a": uint8(9)}},
+		// too short for the longer discriminator
+		{[]byte{1, 2, 3}, "short", map[string]interface{}{"a": uint8(3)}},
+		{[]byte{9}, "other", map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		res, err := p.InstructionParse(tt.data)
+		if err != nil {
+			t.Errorf("%v: %v", tt.data, err)
+			continue
+		}
+		if res["name"] != tt.name || !reflect.DeepEqual(plainValue(res["data"]), plainValue(tt.args)) {
+			t.Errorf("%v: got %v %v, want %s %v", tt.data, res["name"], res["data"], tt.name, tt.args)
+		}
+	}
+	if _, err := p.InstructionParse([]byte{1, 3, 0}); !errors.Is(err, ErrUnknownDiscriminator) {
+		t.Errorf("got %v, want ErrUnknownDiscriminator", err)
+	}
+
+	for data, name := range map[string]string{"\x05\x06\x07\x08": "Long", "\x05\x06\x08": "Short"} {
+		res, err := p.AccountsParse([]byte(data))
+		if err != nil {
+			t.Errorf("%v: %v", []byte(data), err)
+		} else if res["name"] != name {
+			t.Errorf("%v: got %v, want %s", []byte(data), res["name"], name)
+		}
+	}
+}
+
+func TestDiscriminatorConflicts(t *testing.T) {
+	p, err := NewParserWithJson(indexIdl(overlappingInstructions, overlappingAccounts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DiscriminatorConflict{
+		{Kind: ItemKindInstruction, Name: "short", Other: "long", Discriminator: IdlDiscriminator{1, 2}, OtherDiscriminator: IdlDiscriminator{1, 2, 3, 4}},
+		{Kind: ItemKindAccount, Name: "Short", Other: "Long", Discriminator: IdlDiscriminator{5}, OtherDiscriminator: IdlDiscriminator{5, 6, 7}},
+	}
+	if got := p.DiscriminatorConflicts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	p, err = NewParserWithJson(indexIdl(`{"name": "other", "discriminator": [9], "accounts": [], "args": []}`, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.DiscriminatorConflicts(); len(got) != 0 {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestRejectInvalidDiscriminators(t *testing.T) {
+	tests := []struct {
+		name         string
+		instructions string
+		accounts     string
+		reason       string
+	}{
+		{
+			name:         "empty instruction discriminator",
+			instructions: `{"name": "short", "discriminator": [], "accounts": [], "args": []}`,
+			reason:       "empty discriminator",
+		},
+		{
+			name: "duplicate instruction discriminator",
+			instructions: `{"name": "short", "discriminator": [1, 2], "accounts": [], "args": []},
+    {"name": "long", "discriminator": [1, 2], "accounts": [], "args": []}`,
+			reason: "share discriminator",
+		},
+		{
+			name:     "duplicate account discriminator",
+			accounts: `{"name": "Short", "discriminator": [5]}, {"name": "Long", "discriminator": [5]}`,
+			reason:   "share discriminator",
+		},
+	}
+	for _, tt := range tests {
+		_, err := NewParserWithJson(indexIdl(tt.instructions, tt.accounts))
+		if !errors.Is(err, ErrInvalidIdl) || !strings.Contains(err.Error(), tt.reason) {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package anchor_idl_parser
+
+import (
+	"fmt"
+)
+
+// InstructionAccount is an instruction account key labelled with its IDL
+// definition. Accounts of composite groups are flattened in order, with Path
+// holding the dotted group prefix, e.g. "vaults.vault_a".
+type InstructionAccount struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Pubkey   string `json:"pubkey"`
+	Writable bool   `json:"writable"`
+	Signer   bool   `json:"signer"`
+	Optional bool   `json:"optional"`
+	// Absent marks an optional account that was passed as the program id,
+	// which is how Anchor encodes None for optional accounts.
+	Absent bool `json:"absent,omitempty"`
+	// Remaining marks keys past the accounts declared in the IDL.
+	Remaining bool `json:"remaining,omitempty"`
+}
+
+// FlattenAccounts returns the leaf accounts of the instruction in the order
+// they appear in the instruction account list. Pubkey is left empty.
+func (ins *IdlInstruction) FlattenAccounts() []InstructionAccount {
+	return flattenAccountItems(ins.Accounts, "", nil)
+}
+
+func flattenAccountItems(items []IdlInstructionAccountItem, prefix string, res []InstructionAccount) []InstructionAccount {
+	for i := range items {
+		item := &items[i]
+		path := item.Name
+		if prefix != "" {
+			path = prefix + "." + item.Name
+		}
+		if item.IsComposite() {
+			res = flattenAccountItems(item.Accounts, path, res)
+			continue
+		}
+		res = append(res, InstructionAccount{
+			Name:     item.Name,
+			Path:     path,
+			Writable: item.Writable,
+			Signer:   item.Signer,
+			Optional: item.Optional,
+		})
+	}
+	return res
+}
+
+// InstructionParseWithAccounts decodes the instruction like InstructionParse
+// and labels accountKeys, the ordered account pubkeys of the instruction,
+// with their IDL names and flags under the "accounts" key.
+func (p *Parser) InstructionParseWithAccounts(data []byte, accountKeys []string) (map[string]interface{}, error) {
+	argsValues, err := p.InstructionParse(data)
+	if err != nil {
+		return nil, err
+	}
+	if argsValues["type"] != "instruction" {
+		return argsValues, nil
+	}
+	instruction := p.idl.FindInstruction(argsValues["name"].(string))
+	if instruction == nil {
+		return nil, fmt.Errorf("%w: %s", ErrInstructionNotFound, argsValues["name"])
+	}
+	accounts, err := p.mapInstructionAccounts(instruction, accountKeys)
+	if err != nil {
+		return nil, err
+	}
+	argsValues["accounts"] = accounts
+	return argsValues, nil
+}
+
+func (p *Parser) mapInstructionAccounts(instruction *IdlInstruction, accountKeys []string) ([]InstructionAccount, error) {
+	accounts := instruction.FlattenAccounts()
+	if len(accountKeys) < len(accounts) {
+		return nil, fmt.Errorf("%w: instruction %s expects %d accounts, got %d", ErrMissingAccounts, instruction.Name, len(accounts), len(accountKeys))
+	}
+	programId := p.idl.ProgramAddress()
+	for i := range accounts {
+		accounts[i].Pubkey = accountKeys[i]
+		if accounts[i].Optional && programId != "" && accountKeys[i] == programId {
+			accounts[i].Absent = true
+		}
+	}
+	for _, key := range accountKeys[len(accounts):] {
+		accounts = append(accounts, InstructionAccount{Pubkey: key, Remaining: true})
+	}
+	return accounts, nil
+}
@@ -0,0 +1,71 @@
+package anchor_idl_parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const accountsProgram = "Acct111111111111111111111111111111111111111"
+
+const instructionAccountsIdl = `{
+  "address": "` + accountsProgram + `",
+  "metadata": {"name": "accounts", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "swap", "discriminator": [1, 2, 3, 4, 5, 6, 7, 8], "accounts": [
+      {"name": "user", "signer": true},
+      {"name": "pools", "accounts": [
+        {"name": "pool", "writable": true},
+        {"name": "vaults", "accounts": [
+          {"name": "vault_a", "writable": true},
+          {"name": "vault_b", "writable": true}
+        ]}
+      ]},
+      {"name": "referrer", "optional": true}
+    ], "args": [{"name": "amount", "type": "u8"}]}
+  ]
+}`
+
+var swapData = []byte{1, 2, 3, 4, 5, 6, 7, 8, 5}
+
+func TestInstructionParseWithAccounts(t *testing.T) {
+	p, err := NewParserWithJson(instructionAccountsIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"User", "Pool", "VaultA", "VaultB", accountsProgram, "Extra1", "Extra2"}
+	res, err := p.InstructionParseWithAccounts(swapData, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InstructionAccount{
+		{Name: "user", Path: "user", Pubkey: "User", Signer: true},
+		{Name: "pool", Path: "pools.pool", Pubkey: "Pool", Writable: true},
+		{Name: "vault_a", Path: "pools.vaults.vault_a", Pubkey: "VaultA", Writable: true},
+		{Name: "vault_b", Path: "pools.vaults.vault_b", Pubkey: "VaultB", Writable: true},
+		{Name: "referrer", Path: "referrer", Pubkey: accountsProgram, Optional: true, Absent: true},
+		{Pubkey: "Extra1", Remaining: true},
+		{Pubkey: "Extra2", Remaining: true},
+	}
+	if got := res["accounts"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if amount := res["data"].(map[string]interface{})["amount"]; amount != uint8(5) {
+		t.Errorf("got amount %v", amount)
+	}
+
+	// a passed optional account is present
+	keys[4] = "Referrer"
+	res, err = p.InstructionParseWithAccounts(swapData, keys[:5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := res["accounts"].([]InstructionAccount)
+	if len(accounts) != 5 || accounts[4].Absent || accounts[4].Pubkey != "Referrer" {
+		t.Errorf("got %+v", accounts)
+	}
+
+	if _, err := p.InstructionParseWithAccounts(swapData, keys[:4]); !errors.Is(err, ErrMissingAccounts) {
+		t.Errorf("got %v, want ErrMissingAccounts", err)
+	}
+}
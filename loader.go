@@ -0,0 +1,151 @@
+package anchor_idl_parser
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LoadError is a file that could not be loaded into a registry.
+type LoadError struct {
+	Path string
+	Err  error
+}
+
+func (e *LoadError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// DuplicateProgram lists IDL files that declare the same program ID. Path is
+// the file that was registered, the one with the highest program version.
+type DuplicateProgram struct {
+	ProgramId string
+	Path      string
+	Version   string
+	Skipped   []string
+}
+
+// LoadReport describes the outcome of loading a directory of IDLs.
+type LoadReport struct {
+	// Loaded maps program IDs to the file registered for them.
+	Loaded     map[string]string
+	Errors     []*LoadError
+	Duplicates []*DuplicateProgram
+}
+
+// NewRegistryWithDir walks dir and registers every *.json IDL it finds, see
+// Registry.LoadDir.
+func NewRegistryWithDir(dir string) (*Registry, *LoadReport, error) {
+	r := NewRegistry()
+	report, err := r.LoadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, report, nil
+}
+
+// LoadDir walks dir, e.g. Anchor's target/idl, and registers every *.json
+// IDL by its program address. Files that fail to parse or have no address
+// are reported in LoadReport.Errors without stopping the walk. When several
+// files declare the same program ID the highest program version is kept and
+// the others are reported in LoadReport.Duplicates. The returned error is
+// only set when dir itself cannot be walked.
+func (r *Registry) LoadDir(dir string) (*LoadReport, error) {
+	report := &LoadReport{Loaded: make(map[string]string)}
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			report.Errors = append(report.Errors, &LoadError{Path: path, Err: err})
+			return nil
+		}
+		if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".json") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	parsers := make(map[string]*Parser)
+	duplicates := make(map[string]*DuplicateProgram)
+	for _, path := range paths {
+		p, err := NewParserWithPath(path)
+		if err != nil {
+			report.Errors = append(report.Errors, &LoadError{Path: path, Err: err})
+			continue
+		}
+		programId := p.GetIdl().ProgramAddress()
+		if programId == "" {
+			report.Errors = append(report.Errors, &LoadError{Path: path, Err: fmt.Errorf("%w: no program address", ErrInvalidIdl)})
+			continue
+		}
+		prev, ok := parsers[programId]
+		if !ok {
+			parsers[programId] = p
+			continue
+		}
+		dup := duplicates[programId]
+		if dup == nil {
+			dup = &DuplicateProgram{ProgramId: programId}
+			duplicates[programId] = dup
+			report.Duplicates = append(report.Duplicates, dup)
+		}
+		if compareVersions(p.GetIdl().ProgramVersion(), prev.GetIdl().ProgramVersion()) > 0 {
+			dup.Skipped = append(dup.Skipped, prev.GetIdlPath())
+			parsers[programId] = p
+		} else {
+			dup.Skipped = append(dup.Skipped, path)
+		}
+	}
+	for programId, p := range parsers {
+		r.AddWithProgramId(programId, p)
+		report.Loaded[programId] = p.GetIdlPath()
+		if dup := duplicates[programId]; dup != nil {
+			dup.Path = p.GetIdlPath()
+			dup.Version = p.GetIdl().ProgramVersion()
+		}
+	}
+	return report, nil
+}
+
+// compareVersions compares dotted versions such as "0.1.10" numerically,
+// falling back to string order for parts that are not numbers. Missing parts
+// count as 0, so "1.0" equals "1.0.0".
+func compareVersions(a string, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xErr := strconv.Atoi(x)
+		yn, yErr := strconv.Atoi(y)
+		switch {
+		case xErr == nil && yErr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
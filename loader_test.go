@@ -0,0 +1,133 @@
+package anchor_idl_parser
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	loaderProgramA = "LoadA11111111111111111111111111111111111111"
+	loaderProgramB = "LoadB11111111111111111111111111111111111111"
+)
+
+func loaderIdl(address string, version string) string {
+	return fmt.Sprintf(`{
+  "address": %q,
+  "metadata": {"name": "loader", "version": %q, "spec": "0.1.0"},
+  "instructions": []
+}`, address, version)
+}
+
+func writeIdlFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := writeIdlFiles(t, map[string]string{
+		"a_old.json":       loaderIdl(loaderProgramA, "0.9.0"),
+		"a_new.json":       loaderIdl(loaderProgramA, "0.10.0"),
+		"nested/b.json":    loaderIdl(loaderProgramB, "1.0"),
+		"nested/b_2.json":  loaderIdl(loaderProgramB, "1.0.0"),
+		"broken.json":      `{"address": `,
+		"no_address.json":  `{"metadata": {"name": "x", "version": "0.1.0", "spec": "0.1.0"}, "instructions": []}`,
+		"README.md":        "not an idl",
+		"nested/notes.txt": "not an idl",
+	})
+	r, report, err := NewRegistryWithDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLoaded := map[string]string{
+		loaderProgramA: filepath.Join(dir, "a_new.json"),
+		// equal versions keep the first file in path order
+		loaderProgramB: filepath.Join(dir, "nested/b.json"),
+	}
+	if !reflect.DeepEqual(report.Loaded, wantLoaded) || r.Len() != 2 {
+		t.Errorf("got %v, want %v", report.Loaded, wantLoaded)
+	}
+
+	wantDuplicates := []*DuplicateProgram{
+		{ProgramId: loaderProgramA, Path: filepath.Join(dir, "a_new.json"), Version: "0.10.0", Skipped: []string{filepath.Join(dir, "a_old.json")}},
+		{ProgramId: loaderProgramB, Path: filepath.Join(dir, "nested/b.json"), Version: "1.0", Skipped: []string{filepath.Join(dir, "nested/b_2.json")}},
+	}
+	if !reflect.DeepEqual(report.Duplicates, wantDuplicates) {
+		for _, dup := range report.Duplicates {
+			t.Errorf("got %+v", dup)
+		}
+	}
+
+	if len(report.Errors) != 2 {
+		t.Fatalf("got errors %v", report.Errors)
+	}
+	if report.Errors[0].Path != filepath.Join(dir, "broken.json") {
+		t.Errorf("got %v", report.Errors[0])
+	}
+	if report.Errors[1].Path != filepath.Join(dir, "no_address.json") || !errors.Is(report.Errors[1], ErrInvalidIdl) {
+		t.Errorf("got %v", report.Errors[1])
+	}
+
+	if _, _, err := NewRegistryWithDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("walked a missing directory")
+	}
+}
+
+func TestLoadDirUnreadableSubdir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read every directory")
+	}
+	dir := writeIdlFiles(t, map[string]string{
+		"a.json":        loaderIdl(loaderProgramA, "0.1.0"),
+		"locked/b.json": loaderIdl(loaderProgramB, "0.1.0"),
+	})
+	locked := filepath.Join(dir, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0o755)
+
+	_, report, err := NewRegistryWithDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Loaded) != 1 || len(report.Errors) != 1 || report.Errors[0].Path != locked || !errors.Is(report.Errors[0], fs.ErrPermission) {
+		t.Errorf("got loaded %v, errors %v", report.Loaded, report.Errors)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"0.10.0", "0.9.0", 1},
+		{"0.1.9", "0.1.10", -1},
+		{"1.0", "1.0.0", 0},
+		{"1", "1.0.1", -1},
+		{"1.0.0-beta", "1.0.0-alpha", 1},
+		{"", "0.1.0", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := compareVersions(tt.b, tt.a); got != -tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
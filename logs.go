@@ -0,0 +1,239 @@
+package anchor_idl_parser
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+const logTruncated = "Log truncated"
+
+// ProgramInvocation is one program invocation rebuilt from transaction logs,
+// with the lines logged while it was the innermost running program.
+type ProgramInvocation struct {
+	ProgramId string
+	// Depth is the invoke stack height, 1 for top-level instructions.
+	Depth int
+	// Logs holds the "Program log:" messages.
+	Logs   []string
+	Events []*LogEvent
+	// ConsumedUnits and ComputeUnits come from the "consumed N of M compute
+	// units" line, and are 0 when it is missing.
+	ConsumedUnits uint64
+	ComputeUnits  uint64
+	// Success is false when the invocation failed or its result line is
+	// missing, e.g. because the logs were truncated.
+	Success bool
+	Error   string
+	// ReturnData is the last data the invocation set with set_return_data.
+	ReturnData []byte
+	// Invocations are the CPIs made by this invocation, in order.
+	Invocations []*ProgramInvocation
+	// Other holds lines of this invocation that are none of the above.
+	Other []string
+}
+
+// LogEvent is a "Program data:" line attributed to the program that logged
+// it. Event is set when an IDL of the program decoded it and Err when
+// decoding failed; both are nil for programs without an IDL.
+type LogEvent struct {
+	ProgramId string
+	Depth     int
+	Data      []byte
+	Event     map[string]interface{}
+	Err       error
+}
+
+// TransactionLogs is the invocation tree of a transaction's log messages.
+type TransactionLogs struct {
+	// Invocations are the top-level instructions, in order.
+	Invocations []*ProgramInvocation
+	// Events are all data lines in log order.
+	Events []*LogEvent
+	// Truncated is set when the runtime cut the logs short.
+	Truncated bool
+	// Unattributed holds lines logged outside of any invocation.
+	Unattributed []string
+}
+
+// ParseTransactionLogs rebuilds the invocation tree of a transaction from
+// its logMessages without decoding events.
+func ParseTransactionLogs(logs []string) *TransactionLogs {
+	return parseTransactionLogs(logs, nil)
+}
+
+// ParseTransactionLogs rebuilds the invocation tree of a transaction and
+// decodes the data lines of this parser's program as events.
+func (p *Parser) ParseTransactionLogs(logs []string) *TransactionLogs {
+	programId := p.idl.ProgramAddress()
+	return parseTransactionLogs(logs, func(id string) *Parser {
+		if id == programId {
+			return p
+		}
+		return nil
+	})
+}
+
+// ParseTransactionLogs rebuilds the invocation tree of a transaction and
+// decodes data lines with the parser of the program that logged them.
+func (r *Registry) ParseTransactionLogs(logs []string) *TransactionLogs {
+	return parseTransactionLogs(logs, func(id string) *Parser {
+		p, _ := r.Parser(id)
+		return p
+	})
+}
+
+func parseTransactionLogs(logs []string, lookup func(programId string) *Parser) *TransactionLogs {
+	res := &TransactionLogs{}
+	var stack []*ProgramInvocation
+	for _, line := range logs {
+		var current *ProgramInvocation
+		if len(stack) > 0 {
+			current = stack[len(stack)-1]
+		}
+		switch {
+		case line == logTruncated:
+			res.Truncated = true
+		case strings.HasPrefix(line, programLogPrefix):
+			if current == nil {
+				res.Unattributed = append(res.Unattributed, line)
+				continue
+			}
+			current.Logs = append(current.Logs, line[len(programLogPrefix):])
+		case strings.HasPrefix(line, programDataPrefix):
+			if current == nil {
+				res.Unattributed = append(res.Unattributed, line)
+				continue
+			}
+			event := decodeLogEvent(current, line, lookup)
+			current.Events = append(current.Events, event)
+			res.Events = append(res.Events, event)
+		case strings.HasPrefix(line, programReturnPrefix):
+			returnData, err := ParseReturnDataLog(line)
+			var invocation *ProgramInvocation
+			if err == nil {
+				invocation = findInvocation(stack, returnData.ProgramId)
+			}
+			switch {
+			case invocation != nil:
+				invocation.ReturnData = returnData.Data
+			case current != nil:
+				current.Other = append(current.Other, line)
+			default:
+				res.Unattributed = append(res.Unattributed, line)
+			}
+		default:
+			programId, rest, ok := parseProgramLine(line)
+			if !ok {
+				if current == nil {
+					res.Unattributed = append(res.Unattributed, line)
+				} else {
+					current.Other = append(current.Other, line)
+				}
+				continue
+			}
+			switch {
+			case strings.HasPrefix(rest, "invoke ["):
+				depth, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rest, "invoke ["), "]"))
+				if err != nil || depth < 1 {
+					depth = len(stack) + 1
+				}
+				// resynchronize when lines were lost
+				if depth-1 < len(stack) {
+					stack = stack[:depth-1]
+				}
+				invocation := &ProgramInvocation{ProgramId: programId, Depth: depth}
+				if len(stack) == 0 {
+					res.Invocations = append(res.Invocations, invocation)
+				} else {
+					parent := stack[len(stack)-1]
+					parent.Invocations = append(parent.Invocations, invocation)
+				}
+				stack = append(stack, invocation)
+			case strings.HasPrefix(rest, "consumed "):
+				if invocation := findInvocation(stack, programId); invocation != nil {
+					invocation.ConsumedUnits, invocation.ComputeUnits = parseConsumed(rest)
+				}
+			case rest == "success":
+				if i := findInvocationIndex(stack, programId); i >= 0 {
+					stack[i].Success = true
+					stack = stack[:i]
+				}
+			case strings.HasPrefix(rest, "failed"):
+				if i := findInvocationIndex(stack, programId); i >= 0 {
+					stack[i].Error = strings.TrimPrefix(strings.TrimPrefix(rest, "failed"), ": ")
+					stack = stack[:i]
+				}
+			default:
+				if current == nil {
+					res.Unattributed = append(res.Unattributed, line)
+				} else {
+					current.Other = append(current.Other, line)
+				}
+			}
+		}
+	}
+	return res
+}
+
+// parseProgramLine splits "Program <id> <rest>" lines.
+func parseProgramLine(line string) (string, string, bool) {
+	if !strings.HasPrefix(line, "Program ") {
+		return "", "", false
+	}
+	programId, rest, ok := strings.Cut(line[len("Program "):], " ")
+	if !ok || programId == "" {
+		return "", "", false
+	}
+	return programId, rest, true
+}
+
+// parseConsumed reads "consumed N of M compute units".
+func parseConsumed(rest string) (uint64, uint64) {
+	fields := strings.Fields(rest)
+	if len(fields) < 4 || fields[2] != "of" {
+		return 0, 0
+	}
+	consumed, _ := strconv.ParseUint(fields[1], 10, 64)
+	limit, _ := strconv.ParseUint(fields[3], 10, 64)
+	return consumed, limit
+}
+
+func findInvocationIndex(stack []*ProgramInvocation, programId string) int {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].ProgramId == programId {
+			return i
+		}
+	}
+	return -1
+}
+
+func findInvocation(stack []*ProgramInvocation, programId string) *ProgramInvocation {
+	if i := findInvocationIndex(stack, programId); i >= 0 {
+		return stack[i]
+	}
+	return nil
+}
+
+// decodeLogEvent decodes a data line, whose payload may be several base64
+// chunks, with the parser of the invocation's program.
+func decodeLogEvent(invocation *ProgramInvocation, line string, lookup func(programId string) *Parser) *LogEvent {
+	event := &LogEvent{ProgramId: invocation.ProgramId, Depth: invocation.Depth}
+	for _, chunk := range strings.Fields(line[len(programDataPrefix):]) {
+		b, err := base64.StdEncoding.DecodeString(chunk)
+		if err != nil {
+			event.Err = &DecodeError{Kind: ItemKindEvent, Reason: "invalid base64: " + err.Error(), Err: ErrInvalidLog}
+			return event
+		}
+		event.Data = append(event.Data, b...)
+	}
+	if lookup == nil {
+		return event
+	}
+	p := lookup(invocation.ProgramId)
+	if p == nil {
+		return event
+	}
+	event.Event, event.Err = p.eventDataParse(event.Data)
+	return event
+}
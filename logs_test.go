@@ -0,0 +1,142 @@
+package anchor_idl_parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	logsProgram = "Logs111111111111111111111111111111111111111"
+	logsCallee  = "Call111111111111111111111111111111111111111"
+	logsOther   = "Unre111111111111111111111111111111111111111"
+)
+
+const logsIdl = `{
+  "address": "` + logsProgram + `",
+  "metadata": {"name": "logs", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [],
+  "events": [{"name": "Changed", "discriminator": [3]}],
+  "types": [{"name": "Changed", "type": {"kind": "struct", "fields": [{"name": "v", "type": "u8"}]}}]
+}`
+
+func TestParseTransactionLogs(t *testing.T) {
+	p, err := NewParserWithJson(logsIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := p.ParseTransactionLogs([]string{
+		"Program log: before any invocation",
+		"Program " + logsProgram + " invoke [1]",
+		"Program log: Instruction: Swap",
+		"Program " + logsCallee + " invoke [2]",
+		"Program log: in callee",
+		// events of the callee are not decoded with the caller's IDL
+		"Program data: Awc=",
+		"Program return: " + logsCallee + " AQI=",
+		"Program " + logsCallee + " consumed 300 of 190000 compute units",
+		"Program " + logsCallee + " success",
+		// back in the caller
+		"Program data: Awk=",
+		"Program return: " + logsProgram + " Aw==",
+		"Program " + logsProgram + " consumed 10000 of 200000 compute units",
+		"Program " + logsProgram + " success",
+		"Program " + logsOther + " invoke [1]",
+		"Program " + logsOther + " failed: custom program error: 0x1",
+	})
+
+	if len(res.Invocations) != 2 {
+		t.Fatalf("got %d top-level invocations", len(res.Invocations))
+	}
+	caller := res.Invocations[0]
+	if caller.ProgramId != logsProgram || caller.Depth != 1 || !caller.Success || caller.Error != "" {
+		t.Errorf("got caller %+v", caller)
+	}
+	if caller.ConsumedUnits != 10000 || caller.ComputeUnits != 200000 {
+		t.Errorf("got units %d of %d", caller.ConsumedUnits, caller.ComputeUnits)
+	}
+	if !reflect.DeepEqual(caller.Logs, []string{"Instruction: Swap"}) || !reflect.DeepEqual(caller.ReturnData, []byte{3}) {
+		t.Errorf("got logs %q, return data %v", caller.Logs, caller.ReturnData)
+	}
+	if len(caller.Invocations) != 1 {
+		t.Fatalf("got %d CPIs", len(caller.Invocations))
+	}
+	callee := caller.Invocations[0]
+	if callee.ProgramId != logsCallee || callee.Depth != 2 || !callee.Success || callee.ConsumedUnits != 300 {
+		t.Errorf("got callee %+v", callee)
+	}
+	if !reflect.DeepEqual(callee.Logs, []string{"in callee"}) || !reflect.DeepEqual(callee.ReturnData, []byte{1, 2}) {
+		t.Errorf("got logs %q, return data %v", callee.Logs, callee.ReturnData)
+	}
+
+	// data lines belong to the running program
+	if len(res.Events) != 2 || len(callee.Events) != 1 || len(caller.Events) != 1 {
+		t.Fatalf("got events %+v", res.Events)
+	}
+	if e := callee.Events[0]; e.ProgramId != logsCallee || e.Depth != 2 || e.Event != nil || e.Err != nil || !reflect.DeepEqual(e.Data, []byte{3, 7}) {
+		t.Errorf("got callee event %+v", e)
+	}
+	if e := caller.Events[0]; e.ProgramId != logsProgram || e.Depth != 1 || e.Err != nil || e.Event["data"].(map[string]interface{})["v"] != uint8(9) {
+		t.Errorf("got caller event %+v", e)
+	}
+
+	failed := res.Invocations[1]
+	if failed.ProgramId != logsOther || failed.Success || failed.Error != "custom program error: 0x1" {
+		t.Errorf("got failed invocation %+v", failed)
+	}
+	if !reflect.DeepEqual(res.Unattributed, []string{"Program log: before any invocation"}) || res.Truncated {
+		t.Errorf("got unattributed %q, truncated %v", res.Unattributed, res.Truncated)
+	}
+}
+
+func TestParseTransactionLogsFailedCpi(t *testing.T) {
+	res := ParseTransactionLogs([]string{
+		"Program " + logsProgram + " invoke [1]",
+		"Program " + logsCallee + " invoke [2]",
+		"Program " + logsCallee + " failed: insufficient funds",
+		"Program " + logsProgram + " failed: insufficient funds",
+	})
+	caller := res.Invocations[0]
+	callee := caller.Invocations[0]
+	if caller.Success || caller.Error != "insufficient funds" || callee.Success || callee.Error != "insufficient funds" {
+		t.Errorf("got caller %+v, callee %+v", caller, callee)
+	}
+}
+
+func TestParseTransactionLogsTruncated(t *testing.T) {
+	res := ParseTransactionLogs([]string{
+		"Program " + logsProgram + " invoke [1]",
+		"Program " + logsCallee + " invoke [2]",
+		"Program log: in callee",
+		logTruncated,
+	})
+	if !res.Truncated || len(res.Invocations) != 1 {
+		t.Fatalf("got %+v", res)
+	}
+	caller := res.Invocations[0]
+	if caller.Success || caller.Error != "" || len(caller.Invocations) != 1 {
+		t.Errorf("got caller %+v", caller)
+	}
+	if callee := caller.Invocations[0]; callee.Success || !reflect.DeepEqual(callee.Logs, []string{"in callee"}) {
+		t.Errorf("got callee %+v", callee)
+	}
+}
+
+func TestParseTransactionLogsMissingResult(t *testing.T) {
+	// the result line of the first CPI is lost, the depth of the next invoke
+	// puts it back under the caller
+	res := ParseTransactionLogs([]string{
+		"Program " + logsProgram + " invoke [1]",
+		"Program " + logsCallee + " invoke [2]",
+		"Program " + logsOther + " invoke [2]",
+		"Program " + logsOther + " success",
+		"Program log: in caller",
+		"Program " + logsProgram + " success",
+	})
+	caller := res.Invocations[0]
+	if len(caller.Invocations) != 2 || !caller.Success || !reflect.DeepEqual(caller.Logs, []string{"in caller"}) {
+		t.Fatalf("got caller %+v", caller)
+	}
+	if first, second := caller.Invocations[0], caller.Invocations[1]; first.Success || second.ProgramId != logsOther || second.Depth != 2 || !second.Success {
+		t.Errorf("got CPIs %+v %+v", first, second)
+	}
+}
@@ -0,0 +1,90 @@
+package anchor_idl_parser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bytedance/sonic"
+)
+
+const optionIdl = `{
+  "address": "Opti111111111111111111111111111111111111111",
+  "metadata": {"name": "option", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "set", "discriminator": [1], "accounts": [], "args": [
+      {"name": "opt", "type": {"option": "u16"}},
+      {"name": "copt", "type": {"coption": "u16"}},
+      {"name": "tail", "type": "u8"}]}
+  ]
+}`
+
+func TestExtractOption(t *testing.T) {
+	p, err := NewParserWithJson(optionIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"some", []byte{1, 1, 0x34, 0x12, 1, 0, 0, 0, 0x78, 0x56, 9}, `{"copt":22136,"opt":4660,"tail":9}`},
+		// a none option is its 1 byte tag, a none coption keeps the
+		// size of its value after the 4 byte tag
+		{"none", []byte{1, 0, 0, 0, 0, 0, 0, 0, 9}, `{"copt":null,"opt":null,"tail":9}`},
+		{"mixed", []byte{1, 0, 1, 0, 0, 0, 0x78, 0x56, 9}, `{"copt":22136,"opt":null,"tail":9}`},
+	}
+	for _, tt := range tests {
+		res, err := p.InstructionParse(tt.data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		json, _ := sonic.Marshal(res["data"])
+		if string(json) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, json, tt.want)
+		}
+	}
+
+	// invalid tags decode as none and skip the tag, or the whole coption
+	for name, tt := range map[string]struct {
+		data []byte
+		want string
+	}{
+		"option tag":  {[]byte{1, 2, 0, 0, 0, 0, 0, 0, 0, 9}, `{"copt":null,"opt":null,"tail":0}`},
+		"coption tag": {[]byte{1, 0, 2, 0, 0, 0, 0, 0, 9}, `{"copt":null,"opt":null,"tail":9}`},
+	} {
+		res, err := p.InstructionParse(tt.data)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		json, _ := sonic.Marshal(res["data"])
+		if string(json) != tt.want {
+			t.Errorf("%s: got %s, want %s", name, json, tt.want)
+		}
+	}
+}
+
+func TestExtractOptionStrict(t *testing.T) {
+	p, err := NewParserWithJson(optionIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetStrict(true)
+	tests := []struct {
+		name   string
+		data   []byte
+		target error
+	}{
+		{"option tag", []byte{1, 2, 0, 0, 0, 0, 0, 0, 0, 9}, ErrInvalidData},
+		{"coption tag", []byte{1, 0, 2, 0, 0, 0, 0, 0, 9}, ErrInvalidData},
+		{"coption tag high bytes", []byte{1, 0, 0, 0, 0, 1, 0, 0, 9}, ErrInvalidData},
+		{"truncated coption", []byte{1, 0, 1, 0, 0, 0, 0x78}, ErrTruncatedData},
+	}
+	for _, tt := range tests {
+		if _, err := p.InstructionParse(tt.data); !errors.Is(err, tt.target) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.target)
+		}
+	}
+}
@@ -2,28 +2,60 @@ package anchor_idl_parser
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
-	"errors"
+	"fmt"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/bytedance/sonic"
 
 	"github.com/heroims/anchor-idl-parser-go/utils"
 )
 
+const (
+	programLogPrefix  = "Program log: "
+	programDataPrefix = "Program data: "
+)
+
+// eventCpiDiscriminator prefixes the instruction data of the self-CPI Anchor
+// uses to emit events with emit_cpi!.
+var eventCpiDiscriminator = func() []byte {
+	b, _ := hex.DecodeString("1d9acb512ea545e4")
+	return utils.ReverseBytes(b)
+}()
+
 type Parser struct {
 	idlPath string
 	idlJson string
 	idlMap  map[string]interface{}
+	idl     *Idl
+
+	instructionIndex *discriminatorIndex
+	accountIndex     *discriminatorIndex
+	eventIndex       *discriminatorIndex
+	conflicts        []DiscriminatorConflict
+	// handlersMu guards typeHandlers, which is replaced rather than
+	// modified, and recompiling.
+	handlersMu   sync.Mutex
+	typeHandlers map[string]TypeHandler
+	compiled     atomic.Pointer[typeEnv]
+
+	legacyStrings  bool
+	strict         bool
+	accountPadding bool
 }
 
 func (p *Parser) GetIdlMap() map[string]interface{} {
 	return p.idlMap
 }
 
+func (p *Parser) GetIdl() *Idl {
+	return p.idl
+}
+
 func (p *Parser) GetIdlJson() string {
 	return p.idlJson
 }
@@ -32,22 +64,49 @@ func (p *Parser) GetIdlPath() string {
 	return p.idlPath
 }
 
+// SetLegacyStringOutput switches decoding back to the original output format,
+// where vec and array values are comma joined strings and structs and enums
+// are JSON strings. By default values are decoded into slices, *OrderedMap
+// and *EnumValue.
+func (p *Parser) SetLegacyStringOutput(enabled bool) {
+	p.legacyStrings = enabled
+}
+
+// SetStrict makes decoding fail with ErrTruncatedData on short buffers,
+// ErrInvalidData on bool, option and enum tags that are out of range, and
+// ErrTrailingData when bytes are left after the last field. Lenient decoding
+// yields nil for such values instead, which hides IDL and program version
+// drift.
+func (p *Parser) SetStrict(enabled bool) {
+	p.strict = enabled
+}
+
+// SetAllowAccountPadding lets strict mode accept trailing bytes after the
+// last field of an account, which are common since accounts are allocated
+// with spare space.
+func (p *Parser) SetAllowAccountPadding(enabled bool) {
+	p.accountPadding = enabled
+}
+
+func (p *Parser) newDecodeContext() *decodeContext {
+	return &decodeContext{
+		typeEnv:       p.env(),
+		legacyStrings: p.legacyStrings,
+		strict:        p.strict,
+	}
+}
+
 func NewParserWithPath(idlPath string) (*Parser, error) {
 	idlData, err := os.ReadFile(idlPath)
 	if err != nil {
 		return nil, err
 	}
-	idlJson := string(idlData)
-	var idlMap map[string]interface{}
-	err = sonic.Unmarshal([]byte(idlJson), &idlMap)
+	parser, err := NewParserWithJson(string(idlData))
 	if err != nil {
 		return nil, err
 	}
-	return &Parser{
-		idlPath: idlPath,
-		idlJson: idlJson,
-		idlMap:  idlMap,
-	}, nil
+	parser.idlPath = idlPath
+	return parser, nil
 }
 
 func NewParserWithJson(idlJson string) (*Parser, error) {
@@ -56,172 +115,234 @@ func NewParserWithJson(idlJson string) (*Parser, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Parser{
-		idlPath: "",
-		idlJson: idlJson,
-		idlMap:  idlMap,
-	}, nil
+	return newParser(idlJson, idlMap)
 }
 
 func NewParserWithJsonMap(idlMap map[string]interface{}) (*Parser, error) {
 	jsonBytes, err := sonic.Marshal(idlMap)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdl, err)
+	}
+	return newParser(string(jsonBytes), idlMap)
+}
+
+func newParser(idlJson string, idlMap map[string]interface{}) (*Parser, error) {
+	idl := &Idl{}
+	if err := sonic.Unmarshal([]byte(idlJson), idl); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdl, err)
+	}
+	if err := idl.Validate(); err != nil {
+		return nil, err
 	}
-	return &Parser{
+	if err := normalizeIdl(idl, false); err != nil {
+		return nil, err
+	}
+	p := &Parser{
 		idlPath: "",
-		idlJson: string(jsonBytes),
+		idlJson: idlJson,
 		idlMap:  idlMap,
-	}, nil
+		idl:     idl,
+	}
+	if err := p.buildIndexes(); err != nil {
+		return nil, err
+	}
+	p.compiled.Store(compileTypeEnv(p.idl, p.typeHandlers))
+	return p, nil
 }
 
 func (p *Parser) InstructionParse(data []byte) (map[string]interface{}, error) {
-	if len(data) < 8 {
-		return nil, errors.New("invalid data length")
+	if len(data) == 0 {
+		return nil, &DecodeError{Kind: ItemKindInstruction, Reason: "invalid data length", Err: ErrTruncatedData}
 	}
 
-	hexStr := "1d9acb512ea545e4"
-	cpiDiscriminatorBytes, err := hex.DecodeString(hexStr)
-	cpiDiscriminatorBytes = utils.ReverseBytes(cpiDiscriminatorBytes)
-	if err != nil {
-		return nil, errors.New("DecodeString failed")
+	if bytes.HasPrefix(data, eventCpiDiscriminator) {
+		return p.cpiEventParse(data[len(eventCpiDiscriminator):])
 	}
-	if bytes.Equal(data[:8], cpiDiscriminatorBytes) {
-		return p.cpiEventParse(data[8:])
+
+	if i, ok := p.instructionIndex.lookup(data); ok {
+		instruction := &p.idl.Instructions[i]
+		return p.decodeItem(ItemKindInstruction, instruction.Name, instruction.Discriminator, data, &p.env().instructions[i])
 	}
+	return nil, unknownDiscriminatorError(ItemKindInstruction, data)
+}
 
-	instructions, ok := p.idlMap["instructions"].([]interface{})
-	if !ok {
-		return nil, errors.New("instructions not found in IDL")
+func (p *Parser) AccountsParse(data []byte) (map[string]interface{}, error) {
+	if i, ok := p.accountIndex.lookup(data); ok {
+		account := &p.idl.Accounts[i]
+		return p.decodeItem(ItemKindAccount, account.Name, account.Discriminator, data, &p.env().accounts[i])
 	}
+	return nil, unknownDiscriminatorError(ItemKindAccount, data)
+}
 
-	types, ok := p.idlMap["types"].([]interface{})
-	if !ok {
-		return nil, errors.New("types not found in IDL")
+// decodeItem decodes the fields following discriminator.
+func (p *Parser) decodeItem(kind string, name string, discriminator IdlDiscriminator, data []byte, plan *itemPlan) (map[string]interface{}, error) {
+	if plan.zeroCopyErr != nil {
+		return nil, &DecodeError{Kind: kind, Name: name, Discriminator: discriminator, Offset: len(discriminator), Err: plan.zeroCopyErr}
+	}
+	ctx := p.newDecodeContext()
+	if kind == ItemKindInstruction {
+		ctx.pushField("args")
+	}
+	payload := data[len(discriminator):]
+	var values map[string]interface{}
+	var n int
+	if plan.zeroCopy != nil {
+		values, n = extractZeroCopyArgs(payload, plan.args, plan.zeroCopy, ctx)
+	} else {
+		values, n = extractArgs(payload, plan.args, ctx)
+	}
+	if n < len(payload) && !(kind == ItemKindAccount && p.accountPadding) {
+		ctx.path = ctx.path[:0]
+		ctx.failStrict(n, ErrTrailingData, "%d bytes left after the last field", len(payload)-n)
+	}
+	if ctx.err != nil {
+		ctx.err.Kind = kind
+		ctx.err.Name = name
+		ctx.err.Discriminator = discriminator
+		ctx.err.Offset += len(discriminator)
+		return nil, ctx.err
 	}
 
-	for _, instruction := range instructions {
-		instructionMap, ok := instruction.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		if discriminator, ok := instructionMap["discriminator"].([]interface{}); ok {
-			discriminatorBytesLen := len(discriminator)
-
-			discriminatorBytes := make([]byte, discriminatorBytesLen)
-			for i, val := range discriminator {
-				if valValue, ok := val.(float64); ok {
-					discriminatorBytes[i] = byte(valValue)
-				}
-			}
-
-			if bytes.Equal(data[:discriminatorBytesLen], discriminatorBytes) {
-				argsValues := make(map[string]interface{})
-				argsValues["name"] = instructionMap["name"]
-				argsValues["discriminator"] = instructionMap["discriminator"]
-				if argsValue, ok := instructionMap["args"].([]interface{}); ok {
-					argsValues["data"] = extractArgs(data[discriminatorBytesLen:], argsValue, types)
-				}
-				argsValues["type"] = "instruction"
-				return argsValues, nil
-			}
-		} else {
-			instructionName, ok := instructionMap["name"].(string)
-
-			if !ok {
-				continue
-			}
-			instructionName = utils.ToSnakeCase(instructionName)
-			hash := sha256.Sum256([]byte("global:" + instructionName))
-
-			if bytes.Equal(data[:8], hash[:8]) {
-				argsValues := make(map[string]interface{})
-				argsValues["name"] = instructionMap["name"]
-				argsValues["data"] = extractArgs(data[8:], instructionMap["args"].([]interface{}), types)
-				argsValues["type"] = "instruction"
-				return argsValues, nil
-			}
-		}
+	argsValues := make(map[string]interface{})
+	argsValues["name"] = name
+	argsValues["discriminator"] = discriminator
+	argsValues["data"] = values
+	argsValues["type"] = kind
+	return argsValues, nil
+}
+
+func unknownDiscriminatorError(kind string, data []byte) error {
+	return &DecodeError{
+		Kind:          kind,
+		Discriminator: data[:min(8, len(data))],
+		Reason:        fmt.Sprintf("can't find %s", kind),
+		Err:           ErrUnknownDiscriminator,
 	}
-	return nil, errors.New("can't find instruction")
 }
 
-func (p *Parser) AccountsParse(data []byte) (map[string]interface{}, error) {
-	accounts, ok := p.idlMap["accounts"].([]interface{})
-	if !ok {
-		return nil, errors.New("accounts not found in IDL")
+// InstructionEncode builds instruction data for the named instruction: the
+// discriminator followed by the Borsh encoded args. args is a map or
+// *OrderedMap keyed by arg name, holding values shaped like decoder output.
+func (p *Parser) InstructionEncode(name string, args interface{}) ([]byte, error) {
+	instruction := p.idl.FindInstruction(name)
+	if instruction == nil {
+		return nil, fmt.Errorf("%w: %s", ErrInstructionNotFound, name)
 	}
+	buf := append([]byte{}, instruction.Discriminator...)
+	return encodeArgs(buf, p.newEncodeContext(), instruction.Args, args, "args")
+}
 
-	types, ok := p.idlMap["types"].([]interface{})
-	if !ok {
-		return nil, errors.New("types not found in IDL")
+// AccountsEncode builds account data for the named account type: the
+// discriminator followed by the Borsh encoded fields, or by the in memory
+// layout for zero copy accounts.
+func (p *Parser) AccountsEncode(name string, value interface{}) ([]byte, error) {
+	account, plan := p.accountPlan(name)
+	if account == nil {
+		return nil, fmt.Errorf("%w: %s", ErrAccountNotFound, name)
+	}
+	if plan.zeroCopyErr != nil {
+		return nil, &EncodeError{Err: plan.zeroCopyErr}
 	}
+	buf := append([]byte{}, account.Discriminator...)
+	if plan.zeroCopy != nil {
+		borsh, err := encodeArgs(nil, p.newEncodeContext(), plan.fields, value, "")
+		if err != nil {
+			return nil, err
+		}
+		return plan.zeroCopy.scatter(buf, borsh)
+	}
+	return encodeArgs(buf, p.newEncodeContext(), plan.fields, value, "")
+}
 
-	for _, account := range accounts {
-		accountMap, ok := account.(map[string]interface{})
+// AccountsEncodeWithSpace is AccountsEncode with the result zero padded to
+// space bytes, the size the account was allocated with. A space of 0 uses
+// AccountSize, which requires a fixed size layout.
+func (p *Parser) AccountsEncodeWithSpace(name string, value interface{}, space int) ([]byte, error) {
+	if space <= 0 {
+		size, ok := p.AccountSize(name)
 		if !ok {
-			continue
+			return nil, newEncodeError("", ErrInvalidValue, "account %s has no fixed size, space is required", name)
+		}
+		space = size
+	}
+	buf, err := p.AccountsEncode(name, value)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) > space {
+		return nil, newEncodeError("", ErrInvalidValue, "account %s needs %d bytes, space is %d", name, len(buf), space)
+	}
+	return append(buf, make([]byte, space-len(buf))...), nil
+}
+
+// AccountSize returns the discriminator plus data size of the named account
+// when every field has a fixed size.
+func (p *Parser) AccountSize(name string) (int, bool) {
+	account, plan := p.accountPlan(name)
+	if account == nil || plan.size < 0 {
+		return 0, false
+	}
+	return len(account.Discriminator) + plan.size, true
+}
+
+func (p *Parser) instructionPlan(name string) (*IdlInstruction, *itemPlan) {
+	for i := range p.idl.Instructions {
+		if p.idl.Instructions[i].Name == name {
+			return &p.idl.Instructions[i], &p.env().instructions[i]
 		}
-		if discriminator, ok := accountMap["discriminator"].([]interface{}); ok {
-			discriminatorBytesLen := len(discriminator)
-
-			discriminatorBytes := make([]byte, discriminatorBytesLen)
-			for i, val := range discriminator {
-				if valValue, ok := val.(float64); ok {
-					discriminatorBytes[i] = byte(valValue)
-				}
-			}
-			if bytes.Equal(data[:discriminatorBytesLen], discriminatorBytes) {
-				argsValues := make(map[string]interface{})
-				argsValues["discriminator"] = discriminator
-				var accountArgs []interface{}
-				for _, typeVal := range types {
-					typeMap, ok := typeVal.(map[string]interface{})
-					if !ok {
-						continue
-					}
-					if typeMap["name"] == accountMap["name"] {
-						if typeDetails, ok := typeMap["type"].(map[string]interface{}); ok {
-							if tmpAccountArgs, ok := typeDetails["fields"].([]interface{}); ok {
-								accountArgs = tmpAccountArgs
-							}
-						}
-						break
-					}
-				}
-				argsValues["data"] = extractArgs(data[discriminatorBytesLen:], accountArgs, types)
-				argsValues["type"] = "account"
-				return argsValues, nil
-			}
-		} else {
-			accountName, ok := accountMap["name"].(string)
-
-			if !ok {
-				continue
-			}
-			hash := sha256.Sum256([]byte("account:" + accountName))
-
-			if bytes.Equal(data[:8], hash[:8]) {
-				argsValues := make(map[string]interface{})
-				argsValues["name"] = accountMap["name"]
-				var accountArgs []interface{}
-				if accountType, ok := accountMap["type"].(map[string]interface{}); ok {
-					if tmpAccountArgs, ok := accountType["fields"].([]interface{}); ok {
-						accountArgs = tmpAccountArgs
-					}
-				}
-				argsValues["data"] = extractArgs(data[8:], accountArgs, types)
-				argsValues["type"] = "account"
-				return argsValues, nil
-			}
+	}
+	return nil, nil
+}
+
+func (p *Parser) accountPlan(name string) (*IdlAccount, *itemPlan) {
+	for i := range p.idl.Accounts {
+		if p.idl.Accounts[i].Name == name {
+			return &p.idl.Accounts[i], &p.env().accounts[i]
 		}
 	}
-	return nil, errors.New("can't find accounts")
+	return nil, nil
+}
+
+// EventEncode builds the raw bytes of the named event: the discriminator
+// followed by the Borsh encoded fields, as carried by a "Program data:" log.
+func (p *Parser) EventEncode(name string, fields interface{}) ([]byte, error) {
+	event := p.idl.FindEvent(name)
+	if event == nil {
+		return nil, fmt.Errorf("%w: %s", ErrEventNotFound, name)
+	}
+	buf := append([]byte{}, event.Discriminator...)
+	return encodeArgs(buf, p.newEncodeContext(), p.env().typeDefFields(event.Name), fields, "")
+}
+
+// EventLogEncode builds the "Program data: <base64>" log line emit! writes
+// for the named event.
+func (p *Parser) EventLogEncode(name string, fields interface{}) (string, error) {
+	data, err := p.EventEncode(name, fields)
+	if err != nil {
+		return "", err
+	}
+	return programDataPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// EventCpiEncode builds the self-CPI instruction data emit_cpi! sends for
+// the named event, which InstructionParse decodes back into the event.
+func (p *Parser) EventCpiEncode(name string, fields interface{}) ([]byte, error) {
+	data, err := p.EventEncode(name, fields)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, eventCpiDiscriminator...), data...), nil
+}
+
+func (p *Parser) newEncodeContext() *encodeContext {
+	return &encodeContext{
+		typeEnv: p.env(),
+	}
 }
 
 func (p *Parser) EventParse(log string) (map[string]interface{}, error) {
-	PROGRAM_LOG := "Program log: "
-	PROGRAM_DATA := "Program data: "
+	PROGRAM_LOG := programLogPrefix
+	PROGRAM_DATA := programDataPrefix
 	PROGRAM_LOG_START_INDEX := len(PROGRAM_LOG)
 	PROGRAM_DATA_START_INDEX := len(PROGRAM_DATA)
 	var logStr string
@@ -230,86 +351,23 @@ func (p *Parser) EventParse(log string) (map[string]interface{}, error) {
 	} else if strings.HasPrefix(log, PROGRAM_DATA) {
 		logStr = log[PROGRAM_DATA_START_INDEX:]
 	} else {
-		return nil, errors.New("log does not start with a valid prefix")
+		return nil, fmt.Errorf("%w: log does not start with a valid prefix", ErrInvalidLog)
 	}
 
 	decoded, err := base64.StdEncoding.DecodeString(logStr)
 	if err != nil {
-		return nil, errors.New("failed to decode base64 log string")
+		return nil, fmt.Errorf("%w: failed to decode base64 log string: %v", ErrInvalidLog, err)
 	}
 
 	return p.eventDataParse(decoded)
 }
 
 func (p *Parser) eventDataParse(data []byte) (map[string]interface{}, error) {
-	events, ok := p.idlMap["events"].([]interface{})
-	if !ok {
-		return nil, errors.New("events not found in IDL")
-	}
-
-	types, ok := p.idlMap["types"].([]interface{})
-	if !ok {
-		return nil, errors.New("types not found in IDL")
-	}
-
-	for _, event := range events {
-		eventMap, ok := event.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		if discriminator, ok := eventMap["discriminator"].([]interface{}); ok {
-			discriminatorBytesLen := len(discriminator)
-
-			discriminatorBytes := make([]byte, discriminatorBytesLen)
-			for i, val := range discriminator {
-				if valValue, ok := val.(float64); ok {
-					discriminatorBytes[i] = byte(valValue)
-				}
-			}
-
-			if bytes.Equal(data[:discriminatorBytesLen], discriminatorBytes) {
-				argsValues := make(map[string]interface{})
-				argsValues["name"] = eventMap["name"]
-				argsValues["discriminator"] = eventMap["discriminator"]
-				var eventArgs []interface{}
-				for _, typeVal := range types {
-					typeMap, ok := typeVal.(map[string]interface{})
-					if !ok {
-						continue
-					}
-					if typeMap["name"] == eventMap["name"] {
-						if typeDetails, ok := typeMap["type"].(map[string]interface{}); ok {
-							if tmpEventArgs, ok := typeDetails["fields"].([]interface{}); ok {
-								eventArgs = tmpEventArgs
-							}
-						}
-						break
-					}
-				}
-				argsValues["data"] = extractArgs(data[discriminatorBytesLen:], eventArgs, types)
-				argsValues["type"] = "event"
-				return argsValues, nil
-			}
-		} else {
-			eventName, ok := eventMap["name"].(string)
-
-			if !ok {
-				continue
-			}
-			hash := sha256.Sum256([]byte("event:" + eventName))
-
-			if bytes.Equal(data[:8], hash[:8]) {
-				argsValues := make(map[string]interface{})
-				argsValues["name"] = eventName
-				if filedValue, ok := eventMap["fields"].([]interface{}); ok {
-					argsValues["data"] = extractArgs(data[8:], filedValue, types)
-				}
-				argsValues["type"] = "event"
-				return argsValues, nil
-			}
-		}
+	if i, ok := p.eventIndex.lookup(data); ok {
+		event := &p.idl.Events[i]
+		return p.decodeItem(ItemKindEvent, event.Name, event.Discriminator, data, &p.env().events[i])
 	}
-	return nil, errors.New("can't find event")
+	return nil, unknownDiscriminatorError(ItemKindEvent, data)
 }
 
 func (p *Parser) cpiEventParse(data []byte) (map[string]interface{}, error) {
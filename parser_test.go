@@ -0,0 +1,213 @@
+package anchor_idl_parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/heroims/anchor-idl-parser-go/utils"
+)
+
+// benchmarkItems is the number of instructions, accounts and events of the
+// benchmark IDL, in the range of large production programs.
+const benchmarkItems = 64
+
+// legacyBenchmarkIdl builds a legacy (pre 0.30) IDL whose discriminators are
+// derived from the item names.
+func legacyBenchmarkIdl() string {
+	var instructions, accounts, events []string
+	for i := 0; i < benchmarkItems; i++ {
+		instructions = append(instructions, fmt.Sprintf(`{"name": "swap%d", "accounts": [
+      {"name": "pool", "isMut": true, "isSigner": false},
+      {"name": "user", "isMut": false, "isSigner": true}
+    ], "args": [
+      {"name": "amount", "type": "u64"},
+      {"name": "minOut", "type": {"option": "u64"}},
+      {"name": "route", "type": {"vec": "publicKey"}},
+      {"name": "params", "type": {"defined": "Params"}},
+      {"name": "side", "type": {"defined": "Side"}}
+    ]}`, i))
+		accounts = append(accounts, fmt.Sprintf(`{"name": "Pool%d", "type": {"kind": "struct", "fields": [
+      {"name": "authority", "type": "publicKey"},
+      {"name": "reserve", "type": "u128"},
+      {"name": "feeBps", "type": "u16"},
+      {"name": "side", "type": {"defined": "Side"}},
+      {"name": "history", "type": {"array": ["u64", 8]}}
+    ]}}`, i))
+		events = append(events, fmt.Sprintf(`{"name": "Swapped%d", "fields": [
+      {"name": "amount", "type": "u64", "index": false},
+      {"name": "side", "type": {"defined": "Side"}, "index": false},
+      {"name": "who", "type": "publicKey", "index": false}
+    ]}`, i))
+	}
+	return `{
+  "version": "0.1.0",
+  "name": "benchmark",
+  "instructions": [` + strings.Join(instructions, ",") + `],
+  "accounts": [` + strings.Join(accounts, ",") + `],
+  "events": [` + strings.Join(events, ",") + `],
+  "types": [
+    {"name": "Params", "type": {"kind": "struct", "fields": [
+      {"name": "fee", "type": "u16"},
+      {"name": "tag", "type": {"array": ["u8", 4]}},
+      {"name": "memo", "type": "string"}
+    ]}},
+    {"name": "Side", "type": {"kind": "enum", "variants": [
+      {"name": "Bid"}, {"name": "Ask", "fields": ["u8", "bool"]}, {"name": "Limit", "fields": [{"name": "price", "type": "u64"}]}
+    ]}}
+  ],
+  "metadata": {"address": "Bench11111111111111111111111111111111111111"}
+}`
+}
+
+type benchmarkData struct {
+	parser      *Parser
+	instruction []byte
+	account     []byte
+	event       string
+}
+
+// newBenchmarkData encodes the last instruction, account and event of the
+// IDL, the worst case for a linear discriminator scan.
+func newBenchmarkData(b *testing.B, spec string) *benchmarkData {
+	idlJson := legacyBenchmarkIdl()
+	if spec == "new" {
+		var err error
+		if idlJson, err = ConvertLegacyIdlJson(idlJson); err != nil {
+			b.Fatal(err)
+		}
+	}
+	p, err := NewParserWithJson(idlJson)
+	if err != nil {
+		b.Fatal(err)
+	}
+	last := benchmarkItems - 1
+	// legacy parsers keep the camelCase names
+	minOut, feeBps := "min_out", "fee_bps"
+	if spec == "legacy" {
+		minOut, feeBps = "minOut", "feeBps"
+	}
+	pubkey := "SeedPubey1111111111111111111111111111111111"
+	side := &EnumValue{Variant: "Limit", Fields: map[string]interface{}{"price": uint64(99)}}
+	res := &benchmarkData{parser: p}
+	res.instruction, err = p.InstructionEncode(fmt.Sprintf("swap%d", last), map[string]interface{}{
+		"amount": uint64(1000000),
+		minOut:   uint64(990000),
+		"route":  []interface{}{pubkey, pubkey, pubkey},
+		"params": map[string]interface{}{"fee": uint16(30), "tag": []interface{}{uint8(1), uint8(2), uint8(3), uint8(4)}, "memo": "benchmark"},
+		"side":   side,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	res.account, err = p.AccountsEncode(fmt.Sprintf("Pool%d", last), map[string]interface{}{
+		"authority": pubkey,
+		"reserve":   "340282366920938463463374607431768211455",
+		feeBps:      uint16(30),
+		"side":      side,
+		"history":   []interface{}{uint64(1), uint64(2), uint64(3), uint64(4), uint64(5), uint64(6), uint64(7), uint64(8)},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	res.event, err = p.EventLogEncode(fmt.Sprintf("Swapped%d", last), map[string]interface{}{
+		"amount": uint64(1000000),
+		"side":   side,
+		"who":    pubkey,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return res
+}
+
+var benchmarkSpecs = []string{"legacy", "new"}
+
+func BenchmarkInstructionParse(b *testing.B) {
+	for _, spec := range benchmarkSpecs {
+		b.Run(spec, func(b *testing.B) {
+			d := newBenchmarkData(b, spec)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := d.parser.InstructionParse(d.instruction); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAccountsParse(b *testing.B) {
+	for _, spec := range benchmarkSpecs {
+		b.Run(spec, func(b *testing.B) {
+			d := newBenchmarkData(b, spec)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := d.parser.AccountsParse(d.account); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEventParse(b *testing.B) {
+	for _, spec := range benchmarkSpecs {
+		b.Run(spec, func(b *testing.B) {
+			d := newBenchmarkData(b, spec)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := d.parser.EventParse(d.event); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDiscriminatorLookup compares the discriminator index with the
+// linear scans over the IDL instructions it replaced, which for legacy IDLs
+// also hashed every instruction name.
+func BenchmarkDiscriminatorLookup(b *testing.B) {
+	d := newBenchmarkData(b, "legacy")
+	instructions := d.parser.idl.Instructions
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, ok := d.parser.instructionIndex.lookup(d.instruction); !ok {
+				b.Fatal("not found")
+			}
+		}
+	})
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			found := false
+			for j := range instructions {
+				if bytes.HasPrefix(d.instruction, instructions[j].Discriminator) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				b.Fatal("not found")
+			}
+		}
+	})
+	b.Run("linear sighash", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			found := false
+			for j := range instructions {
+				if bytes.HasPrefix(d.instruction, sighash("global", utils.ToSnakeCase(instructions[j].Name))) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				b.Fatal("not found")
+			}
+		}
+	})
+}
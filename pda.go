@@ -0,0 +1,126 @@
+package anchor_idl_parser
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/heroims/anchor-idl-parser-go/utils"
+)
+
+const (
+	maxSeedLength = 32
+	maxSeeds      = 16
+	pdaMarker     = "ProgramDerivedAddress"
+)
+
+var (
+	// ed25519 field prime 2^255 - 19 and curve constant d = -121665/121666
+	curveP = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	curveD = func() *big.Int {
+		d := new(big.Int).ModInverse(big.NewInt(121666), curveP)
+		d.Mul(d, big.NewInt(-121665))
+		return d.Mod(d, curveP)
+	}()
+)
+
+// FindProgramAddress derives the program derived address of seeds like
+// Pubkey::find_program_address, returning the address and its bump seed.
+func FindProgramAddress(seeds [][]byte, programId string) (string, uint8, error) {
+	if len(seeds) >= maxSeeds {
+		return "", 0, fmt.Errorf("%w: %d seeds, at most %d allowed", ErrInvalidValue, len(seeds), maxSeeds-1)
+	}
+	withBump := append(append([][]byte{}, seeds...), nil)
+	for bump := 255; bump >= 0; bump-- {
+		withBump[len(seeds)] = []byte{byte(bump)}
+		address, err := CreateProgramAddress(withBump, programId)
+		if err == nil {
+			return address, uint8(bump), nil
+		}
+		if err != errOnCurve {
+			return "", 0, err
+		}
+	}
+	return "", 0, fmt.Errorf("%w: no viable bump seed", ErrInvalidValue)
+}
+
+var errOnCurve = fmt.Errorf("%w: address is on the ed25519 curve", ErrInvalidValue)
+
+// CreateProgramAddress derives the address of seeds like
+// Pubkey::create_program_address, failing when it lands on the ed25519 curve.
+func CreateProgramAddress(seeds [][]byte, programId string) (string, error) {
+	program, err := toPubkey(programId)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidValue, err)
+	}
+	if len(seeds) > maxSeeds {
+		return "", fmt.Errorf("%w: %d seeds, at most %d allowed", ErrInvalidValue, len(seeds), maxSeeds)
+	}
+	h := sha256.New()
+	for _, seed := range seeds {
+		if len(seed) > maxSeedLength {
+			return "", fmt.Errorf("%w: seed longer than %d bytes", ErrInvalidValue, maxSeedLength)
+		}
+		h.Write(seed)
+	}
+	h.Write(program)
+	h.Write([]byte(pdaMarker))
+	address := h.Sum(nil)
+	if isOnCurve(address) {
+		return "", errOnCurve
+	}
+	return utils.EncodeBase58(address), nil
+}
+
+// CreateWithSeed derives an address from a base address, a seed string and
+// an owner program like Pubkey::create_with_seed.
+func CreateWithSeed(base string, seed string, owner string) (string, error) {
+	baseKey, err := toPubkey(base)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidValue, err)
+	}
+	ownerKey, err := toPubkey(owner)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidValue, err)
+	}
+	if len(seed) > maxSeedLength {
+		return "", fmt.Errorf("%w: seed longer than %d bytes", ErrInvalidValue, maxSeedLength)
+	}
+	if len(ownerKey) >= len(pdaMarker) && string(ownerKey[len(ownerKey)-len(pdaMarker):]) == pdaMarker {
+		return "", fmt.Errorf("%w: owner is an illegal program address", ErrInvalidValue)
+	}
+	h := sha256.New()
+	h.Write(baseKey)
+	h.Write([]byte(seed))
+	h.Write(ownerKey)
+	return utils.EncodeBase58(h.Sum(nil)), nil
+}
+
+// isOnCurve reports whether the 32 bytes decompress to an ed25519 point, i.e.
+// whether x^2 = (y^2 - 1) / (d*y^2 + 1) has a solution.
+func isOnCurve(key []byte) bool {
+	le := make([]byte, 32)
+	for i := range le {
+		le[i] = key[31-i]
+	}
+	le[0] &= 0x7f
+	y := new(big.Int).SetBytes(le)
+	y.Mod(y, curveP)
+	y2 := new(big.Int).Mul(y, y)
+	y2.Mod(y2, curveP)
+	u := new(big.Int).Sub(y2, big.NewInt(1))
+	u.Mod(u, curveP)
+	if u.Sign() == 0 {
+		return true
+	}
+	v := new(big.Int).Mul(curveD, y2)
+	v.Add(v, big.NewInt(1))
+	v.Mod(v, curveP)
+	if v.Sign() == 0 {
+		return false
+	}
+	x2 := v.ModInverse(v, curveP)
+	x2.Mul(x2, u)
+	x2.Mod(x2, curveP)
+	return big.Jacobi(x2, curveP) == 1
+}
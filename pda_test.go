@@ -0,0 +1,90 @@
+package anchor_idl_parser
+
+import (
+	"errors"
+	"testing"
+)
+
+// Vectors from the create_program_address tests of solana-program and
+// @solana/web3.js.
+func TestCreateProgramAddress(t *testing.T) {
+	seedKey, err := toPubkey("SeedPubey1111111111111111111111111111111111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		programId string
+		seeds     [][]byte
+		address   string
+	}{
+		{"BPFLoaderUpgradeab1e11111111111111111111111", [][]byte{{}, {1}}, "BwqrghZA2htAcqq8dzP1WDAhTXYTYWj7CHxF5j7TDBAe"},
+		{"BPFLoaderUpgradeab1e11111111111111111111111", [][]byte{[]byte("☉"), {0}}, "13yWmRpaTR4r5nAktwLqMpRNr28tnVUZw26rTvPSSB19"},
+		{"BPFLoaderUpgradeab1e11111111111111111111111", [][]byte{[]byte("Talking"), []byte("Squirrels")}, "2fnQrngrQT4SeLcdToJAD96phoEjNL2man2kfRLCASVk"},
+		{"BPFLoaderUpgradeab1e11111111111111111111111", [][]byte{seedKey, {1}}, "976ymqVnfE32QFe6NfGDctSvVa36LWnvYxhU6G2232YL"},
+		{"BPFLoader1111111111111111111111111111111111", [][]byte{{}, {1}}, "3gF2KMe9KiC6FNVBmfg9i267aMPvK37FewCip4eGBFcT"},
+		{"BPFLoader1111111111111111111111111111111111", [][]byte{[]byte("☉")}, "7ytmC1nT1xY4RfxCV2ZgyA7UakC93do5ZdyhdF3EtPj7"},
+		{"BPFLoader1111111111111111111111111111111111", [][]byte{[]byte("Talking"), []byte("Squirrels")}, "HwRVBufQ4haG5XSgpspwKtNd3PC9GM9m1196uJW36vds"},
+		{"BPFLoader1111111111111111111111111111111111", [][]byte{seedKey}, "GUs5qLUfsEHkcMB9T38vjr18ypEhRuNWiePW2LoK4E3K"},
+	}
+	for _, tt := range tests {
+		address, err := CreateProgramAddress(tt.seeds, tt.programId)
+		if err != nil || address != tt.address {
+			t.Errorf("%q: got %s %v, want %s", tt.seeds, address, err, tt.address)
+		}
+	}
+
+	if _, err := CreateProgramAddress([][]byte{make([]byte, 33)}, "BPFLoaderUpgradeab1e11111111111111111111111"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("got %v, want ErrInvalidValue", err)
+	}
+	if _, err := CreateProgramAddress([][]byte{make([]byte, 32)}, "BPFLoaderUpgradeab1e11111111111111111111111"); err != nil {
+		t.Error(err)
+	}
+}
+
+// The example of the Solana program derived address documentation, whose
+// 255 bump lands on the curve.
+func TestFindProgramAddress(t *testing.T) {
+	seeds := [][]byte{[]byte("helloWorld")}
+	programId := "11111111111111111111111111111111"
+	address, bump, err := FindProgramAddress(seeds, programId)
+	if err != nil || address != "46GZzzetjCURsdFPb7rcnspbEMnCBXe9kpjrsZAkKb6X" || bump != 254 {
+		t.Errorf("got %s %d %v", address, bump, err)
+	}
+	if _, err := CreateProgramAddress(append(seeds, []byte{255}), programId); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("bump 255: got %v, want an on curve error", err)
+	}
+	if address, err := CreateProgramAddress(append(seeds, []byte{253}), programId); err != nil || address != "GBNWBGxKmdcd7JrMnBdZke9Fumj9sir4rpbruwEGmR4y" {
+		t.Errorf("bump 253: got %s %v", address, err)
+	}
+}
+
+// The create_with_seed vector of solana-program.
+func TestCreateWithSeed(t *testing.T) {
+	address, err := CreateWithSeed("11111111111111111111111111111111", "limber chicken: 4/45", "11111111111111111111111111111111")
+	if err != nil || address != "9h1HyLCW5dZnBVap8C5egQ9Z6pHyjsh5MNy83iPqqRuq" {
+		t.Errorf("got %s %v", address, err)
+	}
+	if _, err := CreateWithSeed("11111111111111111111111111111111", string(make([]byte, 33)), "11111111111111111111111111111111"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("got %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestIsOnCurve(t *testing.T) {
+	basePoint := []byte{0x58}
+	for i := 1; i < 32; i++ {
+		basePoint = append(basePoint, 0x66)
+	}
+	identity := make([]byte, 32)
+	identity[0] = 1
+	// y = 2 has no x: (y^2 - 1) / (d*y^2 + 1) is not a square
+	two := make([]byte, 32)
+	two[0] = 2
+	for _, tt := range []struct {
+		key  []byte
+		want bool
+	}{{basePoint, true}, {identity, true}, {two, false}} {
+		if got := isOnCurve(tt.key); got != tt.want {
+			t.Errorf("%x: got %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
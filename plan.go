@@ -0,0 +1,343 @@
+package anchor_idl_parser
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// typeEnv is the compiled form of a parser's IDL: an index of type
+// definitions, the parser's type handlers, the decode plan and fixed size of
+// every instruction, account and event, and caches for generic
+// instantiations and fixed sizes of defined types. It is built when the
+// parser is created and shared by every decode and encode call.
+type typeEnv struct {
+	idl      *Idl
+	handlers map[string]TypeHandler
+	// version is the global handler version the env was compiled against.
+	version uint64
+
+	types  map[string]*IdlTypeDef
+	folded map[string]*IdlTypeDef
+
+	instructions []itemPlan
+	accounts     []itemPlan
+	events       []itemPlan
+
+	// resolved caches generic instantiations, keyed by the reference.
+	resolved sync.Map
+	// sizes caches fixedSize results, keyed like resolved.
+	sizes sync.Map
+	// layouts caches zero copy layouts, keyed like resolved.
+	layouts sync.Map
+}
+
+// itemPlan is the layout of an instruction, account or event.
+type itemPlan struct {
+	fields []IdlField
+	// args decodes fields, returns the return data of instructions.
+	args    *fieldsPlan
+	returns *typePlan
+	// size is the encoded size of fields, or -1 when it depends on the value.
+	size int
+	// zeroCopy is the layout of accounts stored with bytemuck, zeroCopyErr
+	// why such an account has no usable layout.
+	zeroCopy    *zeroCopyLayout
+	zeroCopyErr error
+}
+
+// typePlan is an IdlType compiled for decoding: defined references are
+// resolved to their type handler, definition or generic instantiation once,
+// so decoding does no lookups.
+type typePlan struct {
+	argType *IdlType
+	// builtin is set for primitives extractPrimitive decodes.
+	builtin bool
+	// elem is the item type of vecs, arrays, options and coptions.
+	elem *typePlan
+	// size is the fixed encoded size, -1 when it depends on the value.
+	size    int
+	defined *definedPlan
+}
+
+// definedPlan is a compiled defined type, shared by every reference to it.
+type definedPlan struct {
+	name    string
+	handler *TypeHandler
+	kind    string
+	// fields is nil for structs without fields and variants nil for enums
+	// without variants, like in the IDL.
+	fields   *fieldsPlan
+	variants []variantPlan
+	alias    *typePlan
+	// err is why the type cannot be resolved, reported when a value of it
+	// is decoded.
+	err error
+}
+
+type variantPlan struct {
+	name string
+	// fields is nil for unit variants.
+	fields *fieldsPlan
+}
+
+// fieldsPlan is a compiled list of named or tuple fields. keys and index are
+// shared by every OrderedMap decoded from named fields, slots maps each
+// field to its key, which differ only when a name repeats.
+type fieldsPlan struct {
+	tuple bool
+	names []string
+	types []*typePlan
+	slots []int
+	keys  []string
+	index map[string]int
+}
+
+type fixedSize struct {
+	size int
+	ok   bool
+}
+
+// typeHandlersVersion is bumped by RegisterType and RegisterPrimitive so
+// parsers recompile.
+var typeHandlersVersion atomic.Uint64
+
+func compileTypeEnv(idl *Idl, handlers map[string]TypeHandler) *typeEnv {
+	env := &typeEnv{
+		idl:      idl,
+		handlers: handlers,
+		version:  typeHandlersVersion.Load(),
+		types:    make(map[string]*IdlTypeDef, len(idl.Types)),
+		folded:   make(map[string]*IdlTypeDef, len(idl.Types)),
+	}
+	for i := range idl.Types {
+		typeDef := &idl.Types[i]
+		if _, ok := env.types[typeDef.Name]; !ok {
+			env.types[typeDef.Name] = typeDef
+		}
+		if _, ok := env.folded[strings.ToLower(typeDef.Name)]; !ok {
+			env.folded[strings.ToLower(typeDef.Name)] = typeDef
+		}
+	}
+	c := &planCompiler{env: env, defined: make(map[string]*definedPlan)}
+	env.instructions = make([]itemPlan, len(idl.Instructions))
+	for i := range idl.Instructions {
+		env.instructions[i] = env.compileItem(idl.Instructions[i].Args)
+		env.instructions[i].args = c.compileFields(&IdlDefinedFields{Named: idl.Instructions[i].Args}, 0)
+		if idl.Instructions[i].Returns != nil {
+			env.instructions[i].returns = c.compileType(idl.Instructions[i].Returns, 0)
+		}
+	}
+	env.accounts = make([]itemPlan, len(idl.Accounts))
+	for i := range idl.Accounts {
+		env.accounts[i] = env.compileAccount(idl.Accounts[i].Name)
+		env.accounts[i].args = c.compileFields(&IdlDefinedFields{Named: env.accounts[i].fields}, 0)
+	}
+	env.events = make([]itemPlan, len(idl.Events))
+	for i := range idl.Events {
+		env.events[i] = env.compileItem(env.typeDefFields(idl.Events[i].Name))
+		env.events[i].args = c.compileFields(&IdlDefinedFields{Named: env.events[i].fields}, 0)
+	}
+	return env
+}
+
+func (env *typeEnv) compileItem(fields []IdlField) itemPlan {
+	plan := itemPlan{fields: fields, size: -1}
+	if size, ok := fixedSizeOfFieldsWithDepth(env, &IdlDefinedFields{Named: fields}, 0); ok {
+		plan.size = size
+	}
+	return plan
+}
+
+func (env *typeEnv) compileAccount(name string) itemPlan {
+	plan := env.compileItem(env.typeDefFields(name))
+	if typeDef, ok := env.types[name]; ok && typeDef.IsZeroCopy() {
+		plan.size = -1
+		plan.zeroCopy, plan.zeroCopyErr = env.zeroCopyLayoutOfDefined(&IdlTypeDefined{Name: name}, 0)
+		if plan.zeroCopy != nil {
+			plan.size = plan.zeroCopy.size
+		}
+	}
+	return plan
+}
+
+// planCompiler compiles the types of an env, sharing the plan of each
+// defined type, which also ends recursion through recursive types.
+type planCompiler struct {
+	env     *typeEnv
+	defined map[string]*definedPlan
+}
+
+func (c *planCompiler) compileType(argType *IdlType, depth int) *typePlan {
+	plan := &typePlan{argType: argType, size: -1}
+	if size, ok := fixedSizeOf(c.env, argType); ok {
+		plan.size = size
+	}
+	switch {
+	case argType.Primitive != "":
+		plan.builtin = isBuiltinPrimitive(argType.Primitive)
+	case argType.Vec != nil:
+		plan.elem = c.compileType(argType.Vec, depth+1)
+	case argType.Array != nil:
+		plan.elem = c.compileType(&argType.Array.Elem, depth+1)
+	case argType.Option != nil:
+		plan.elem = c.compileType(argType.Option, depth+1)
+	case argType.COption != nil:
+		plan.elem = c.compileType(argType.COption, depth+1)
+	case argType.Defined != nil:
+		plan.defined = c.compileDefined(argType.Defined, depth+1)
+	}
+	return plan
+}
+
+func (c *planCompiler) compileDefined(defined *IdlTypeDefined, depth int) *definedPlan {
+	key := definedKey(defined)
+	if plan, ok := c.defined[key]; ok {
+		return plan
+	}
+	plan := &definedPlan{name: defined.Name}
+	c.defined[key] = plan
+	if handler, ok := c.env.lookupType(defined.Name); ok {
+		plan.handler = &handler
+		return plan
+	}
+	// generic instantiations that keep growing never repeat a key, named
+	// types always end in the memo
+	if len(defined.Generics) > 0 && depth > maxRecursiveDepth {
+		plan.err = fmt.Errorf("%w: %s nests too deep", ErrMaxDepthExceeded, key)
+		return plan
+	}
+	typeData, err := c.env.resolve(defined)
+	if err != nil {
+		plan.err = err
+		return plan
+	}
+	plan.kind = typeData.Kind
+	switch typeData.Kind {
+	case IdlTypeDefKindStruct:
+		if typeData.Fields != nil {
+			plan.fields = c.compileFields(typeData.Fields, depth+1)
+		}
+	case IdlTypeDefKindEnum:
+		if typeData.Variants != nil {
+			plan.variants = make([]variantPlan, len(typeData.Variants))
+			for i := range typeData.Variants {
+				variant := &typeData.Variants[i]
+				plan.variants[i].name = variant.Name
+				if variant.Fields != nil {
+					plan.variants[i].fields = c.compileFields(variant.Fields, depth+1)
+				}
+			}
+		}
+	case IdlTypeDefKindType:
+		if typeData.Alias != nil {
+			plan.alias = c.compileType(typeData.Alias, depth+1)
+		}
+	}
+	return plan
+}
+
+func (c *planCompiler) compileFields(fields *IdlDefinedFields, depth int) *fieldsPlan {
+	if fields.IsTuple() {
+		plan := &fieldsPlan{tuple: true, types: make([]*typePlan, len(fields.Tuple))}
+		for i := range fields.Tuple {
+			plan.types[i] = c.compileType(&fields.Tuple[i], depth)
+		}
+		return plan
+	}
+	plan := &fieldsPlan{
+		names: make([]string, len(fields.Named)),
+		types: make([]*typePlan, len(fields.Named)),
+		slots: make([]int, len(fields.Named)),
+		index: make(map[string]int, len(fields.Named)),
+	}
+	for i := range fields.Named {
+		name := fields.Named[i].Name
+		slot, ok := plan.index[name]
+		if !ok {
+			slot = len(plan.keys)
+			plan.index[name] = slot
+			plan.keys = append(plan.keys, name)
+		}
+		plan.names[i] = name
+		plan.slots[i] = slot
+		plan.types[i] = c.compileType(&fields.Named[i].Type, depth)
+	}
+	// full capacity so appending to Keys() never writes into the plan
+	plan.keys = plan.keys[:len(plan.keys):len(plan.keys)]
+	return plan
+}
+
+// env returns the compiled IDL, recompiling it when global type handlers
+// changed since the parser was created.
+func (p *Parser) env() *typeEnv {
+	env := p.compiled.Load()
+	if env != nil && env.version == typeHandlersVersion.Load() {
+		return env
+	}
+	p.handlersMu.Lock()
+	defer p.handlersMu.Unlock()
+	if env = p.compiled.Load(); env == nil || env.version != typeHandlersVersion.Load() {
+		env = compileTypeEnv(p.idl, p.typeHandlers)
+		p.compiled.Store(env)
+	}
+	return env
+}
+
+// findTypeDef looks a type definition up like Idl.FindTypeDef.
+func (env *typeEnv) findTypeDef(name string) *IdlTypeDef {
+	if typeDef, ok := env.types[name]; ok {
+		return typeDef
+	}
+	return env.folded[strings.ToLower(name)]
+}
+
+// typeDefFields returns the named fields of the type an account or event
+// stores its layout in.
+func (env *typeEnv) typeDefFields(name string) []IdlField {
+	typeDef, ok := env.types[name]
+	if !ok || typeDef.Type.Fields == nil {
+		return nil
+	}
+	return typeDef.Type.Fields.Named
+}
+
+// resolve returns the definition a defined reference points to like
+// Idl.ResolveDefined, caching generic instantiations.
+func (env *typeEnv) resolve(defined *IdlTypeDefined) (*IdlTypeDefTy, error) {
+	typeDef := env.findTypeDef(defined.Name)
+	if typeDef == nil || len(typeDef.Generics) == 0 {
+		return resolveTypeDef(typeDef, defined)
+	}
+	key := definedKey(defined)
+	if typeData, ok := env.resolved.Load(key); ok {
+		return typeData.(*IdlTypeDefTy), nil
+	}
+	typeData, err := resolveTypeDef(typeDef, defined)
+	if err != nil {
+		return nil, err
+	}
+	env.resolved.Store(key, typeData)
+	return typeData, nil
+}
+
+func definedKey(defined *IdlTypeDefined) string {
+	if len(defined.Generics) == 0 {
+		return defined.Name
+	}
+	return IdlType{Defined: defined}.String()
+}
+
+func (env *typeEnv) lookupType(name string) (TypeHandler, bool) {
+	if handler, ok := env.handlers[name]; ok {
+		return handler, true
+	}
+	if env.findTypeDef(name) != nil {
+		return TypeHandler{}, false
+	}
+	typeHandlersMu.RLock()
+	defer typeHandlersMu.RUnlock()
+	handler, ok := typeHandlers[name]
+	return handler, ok
+}
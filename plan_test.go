@@ -0,0 +1,85 @@
+package anchor_idl_parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bytedance/sonic"
+)
+
+const recursiveIdl = `{
+  "address": "Plan111111111111111111111111111111111111111",
+  "metadata": {"name": "plan", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "tree", "discriminator": [1], "accounts": [],
+     "args": [{"name": "root", "type": {"defined": {"name": "Node"}}}]},
+    {"name": "grow", "discriminator": [2], "accounts": [],
+     "args": [{"name": "head", "type": {"defined": {"name": "Grow", "generics": [{"kind": "type", "type": "u8"}]}}}]}
+  ],
+  "types": [
+    {"name": "Node", "type": {"kind": "struct", "fields": [
+      {"name": "value", "type": "u8"},
+      {"name": "children", "type": {"vec": {"defined": {"name": "Node"}}}}]}},
+    {"name": "Grow", "generics": [{"kind": "type", "name": "T"}],
+     "type": {"kind": "struct", "fields": [
+      {"name": "value", "type": {"generic": "T"}},
+      {"name": "next", "type": {"option": {"defined": {"name": "Grow",
+        "generics": [{"kind": "type", "type": {"vec": {"generic": "T"}}}]}}}}]}}
+  ]
+}`
+
+func TestCompileRecursiveTypes(t *testing.T) {
+	p, err := NewParserWithJson(recursiveIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Node{1, [Node{2, []}]}
+	res, err := p.InstructionParse([]byte{1, 1, 1, 0, 0, 0, 2, 0, 0, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	json, _ := sonic.Marshal(res["data"])
+	if want := `{"root":{"value":1,"children":[{"value":2,"children":[]}]}}`; string(json) != want {
+		t.Errorf("got %s, want %s", json, want)
+	}
+
+	// Grow<u8>{7, Some(Grow<vec<u8>>{[8], None})}
+	res, err = p.InstructionParse([]byte{2, 7, 1, 1, 0, 0, 0, 8, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	json, _ = sonic.Marshal(res["data"])
+	if want := `{"head":{"value":7,"next":{"value":[8],"next":null}}}`; string(json) != want {
+		t.Errorf("got %s, want %s", json, want)
+	}
+
+	// instantiations past the depth limit fail when they are decoded
+	data := []byte{2, 7}
+	for i := 0; i < maxRecursiveDepth; i++ {
+		data = append(data, 1, 0, 0, 0, 0)
+	}
+	if _, err := p.InstructionParse(data); !errors.Is(err, ErrMaxDepthExceeded) {
+		t.Errorf("got %v, want ErrMaxDepthExceeded", err)
+	}
+}
+
+func TestPlannedOrderedMapSet(t *testing.T) {
+	fields := &fieldsPlan{keys: []string{"a", "b"}, index: map[string]int{"a": 0, "b": 1}}
+	m := newPlannedOrderedMap(fields)
+	m.Set("a", 1)
+	m.Set("c", 3)
+	if got := m.Keys(); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("got keys %v", got)
+	}
+	if v, ok := m.Get("c"); !ok || v != 3 {
+		t.Errorf("got %v %v, want 3", v, ok)
+	}
+	// the plan keeps its keys
+	if !reflect.DeepEqual(fields.keys, []string{"a", "b"}) || len(fields.index) != 2 {
+		t.Errorf("plan changed: %v %v", fields.keys, fields.index)
+	}
+	if other := newPlannedOrderedMap(fields); other.Len() != 2 {
+		t.Errorf("got %d keys, want 2", other.Len())
+	}
+}
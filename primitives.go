@@ -5,7 +5,7 @@ import (
 	"math"
 	"math/big"
 
-	"github.com/btcsuite/btcutil/base58"
+	"github.com/heroims/anchor-idl-parser-go/utils"
 )
 
 func extractPrimitive(data []byte, offset int, argType string) (interface{}, int) {
@@ -14,19 +14,12 @@ func extractPrimitive(data []byte, offset int, argType string) (interface{}, int
 	}
 
 	switch argType {
-	case "u128":
-		if len(data[offset:]) < 16 {
-			return nil, 16
+	case "u128", "u256":
+		size := primitiveSizes[argType]
+		if len(data[offset:]) < size {
+			return nil, size
 		} else {
-			b := data[offset : offset+16]
-			bigInt := new(big.Int)
-
-			for i := 0; i < 16; i++ {
-				for j := 0; j < 8; j++ {
-					bigInt.SetBit(bigInt, i*8+j, uint((b[i]&(0b1<<j))>>j))
-				}
-			}
-			return bigInt.String(), 16
+			return littleEndianBigInt(data[offset:offset+size], false).String(), size
 		}
 	case "u64":
 		if len(data[offset:]) < 8 {
@@ -53,56 +46,12 @@ func extractPrimitive(data []byte, offset int, argType string) (interface{}, int
 			return data[offset], 1
 		}
 
-		// that particular binary number uses Two's complement bit weight
-		// https://en.wikipedia.org/wiki/Sign_bit#Sign_bit_weight_in_Two's_Complement
-		// so if the number is negative all bits should be reversed
-		// and later we should add one and then negate the whole thing
-		// lets say we have 1001, to get the number we should
-		// - check the most significant bit
-		// - if it is 0 then procceed like a regular binary number
-		// - if it is 1:
-		// 1) reverse bits 1001 => 0110
-		// 2) add one 0110 => 0111
-		// 3) negate 0111 => -0111
-		// and we got -7, so 1001 is -7
-	case "i128":
-		if len(data[offset:]) < 16 {
-			return nil, 16
-		} else {
-			b := data[offset : offset+16]
-			bigInt := new(big.Int)
-
-			// get last bit:
-			// this number uses little-endian, it means that last byte is 15-th
-			// to get last bit of that byte we should do bitwise AND
-			// <lastByte> AND 10000000 => <lastByte> AND 1 << 7 => <lastByte> AND 0b1 << 7
-			// but in that way we will get either '10000000' or '0000000' and we want 1 or 0
-			// so we need to shift that bit so it becomes first (7 times)
-			// so we will get: (<lastByte> AND 0b1<<7)>>7
-			sign := uint8(int((b[15] & (0b1 << 7)) >> 7))
-			for i := 0; i < 16; i++ {
-				for j := 0; j < 8; j++ {
-
-					// here we take j-th bit and do xor with sign
-					// so if sign is 1 it means that number is negative
-					// and if number is negative we should negate all the bits
-					// sign|bit before|bit after| xor |
-					//  0  |     0    |    0    |0^0=0|
-					//  0  |     1    |    1    |0^1=1|
-					//  1  |     0    |    1    |1^0=1|
-					//  1  |     1    |    0    |1^1=0|
-					// as you can see if sign is one, bit gets negated,
-					// and if sign is zero, it gets untouched
-					bigInt.SetBit(bigInt, i*8+j, uint(((b[i]&(0b1<<j))>>j)^sign))
-				}
-			}
-
-			bigInt.Add(bigInt, big.NewInt(int64(sign)))
-			if sign == 1 {
-				bigInt.Neg(bigInt)
-			}
-
-			return bigInt.String(), 16
+	case "i128", "i256":
+		size := primitiveSizes[argType]
+		if len(data[offset:]) < size {
+			return nil, size
+		} else {
+			return littleEndianBigInt(data[offset:offset+size], true).String(), size
 		}
 	case "i64":
 		if len(data[offset:]) < 8 {
@@ -167,15 +116,18 @@ func extractPrimitive(data []byte, offset int, argType string) (interface{}, int
 		if len(data[offset:]) < 32 {
 			return nil, 32
 		} else {
-			return base58.Encode(data[offset : offset+32]), 32
+			return utils.EncodeBase58(data[offset : offset+32]), 32
 		}
 	case "pubkey":
 		if len(data[offset:]) < 32 {
 			return nil, 32
 		} else {
-			return base58.Encode(data[offset : offset+32]), 32
+			return utils.EncodeBase58(data[offset : offset+32]), 32
 		}
 	case "string":
+		if len(data[offset:]) < 4 {
+			return nil, 0
+		}
 		strLen := binary.LittleEndian.Uint32(data[offset : offset+4])
 		var n int = 4
 		if len(data[offset+n:]) < int(strLen) {
@@ -184,7 +136,32 @@ func extractPrimitive(data []byte, offset int, argType string) (interface{}, int
 			return string(data[offset+n : offset+n+int(strLen)]), n + int(strLen)
 		}
 	case "bytes":
-		return extractVector(data, nil, offset, "u8")
+		// bytes decode to []byte, which JSON encodes as base64, while vec<u8>
+		// decodes element by element to numbers like any other vec
+		if len(data[offset:]) < 4 {
+			return nil, 0
+		}
+		bytesLen := binary.LittleEndian.Uint32(data[offset : offset+4])
+		var n int = 4
+		if len(data[offset+n:]) < int(bytesLen) {
+			return nil, n
+		} else {
+			b := make([]byte, bytesLen)
+			copy(b, data[offset+n:])
+			return b, n + int(bytesLen)
+		}
 	}
 	return nil, 0
 }
+
+// littleEndianBigInt decodes a little-endian integer of any width, in two's
+// complement when signed.
+func littleEndianBigInt(b []byte, signed bool) *big.Int {
+	// SetBytes reads big-endian magnitudes
+	bigInt := new(big.Int).SetBytes(utils.ReverseBytes(b))
+	if signed && len(b) > 0 && b[len(b)-1]&0x80 != 0 {
+		// a set sign bit weighs -2^(8*len(b)-1) instead of 2^(8*len(b)-1)
+		bigInt.Sub(bigInt, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+	}
+	return bigInt
+}
@@ -0,0 +1,201 @@
+package anchor_idl_parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ProgramError is a program error code resolved against the IDL errors and
+// the Anchor framework errors.
+type ProgramError struct {
+	Code uint32
+	Name string
+	Msg  string
+	// Anchor marks errors of the Anchor framework rather than of the program.
+	Anchor bool
+	// Account and Origin ("file:line") say where an AnchorError log was
+	// raised, when the log carries it.
+	Account string
+	Origin  string
+	// Left and Right are the compared values logged by a failed require_*
+	// check.
+	Left  string
+	Right string
+}
+
+func (e *ProgramError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("program error ")
+	if e.Name != "" {
+		sb.WriteString(e.Name)
+		sb.WriteString(" ")
+	}
+	sb.WriteString("(")
+	sb.WriteString(strconv.FormatUint(uint64(e.Code), 10))
+	sb.WriteString(")")
+	if e.Msg != "" {
+		sb.WriteString(": ")
+		sb.WriteString(e.Msg)
+	}
+	return sb.String()
+}
+
+// LookupAnchorError returns the Anchor framework error with the code.
+func LookupAnchorError(code uint32) (*ProgramError, bool) {
+	e, ok := anchorErrors[code]
+	if !ok {
+		return nil, false
+	}
+	return &ProgramError{Code: e.Code, Name: e.Name, Msg: e.Msg, Anchor: true}, true
+}
+
+// DecodeErrorCode resolves a custom program error code, e.g. the n of
+// InstructionError::Custom(n), against the IDL errors and then the Anchor
+// framework errors.
+func (p *Parser) DecodeErrorCode(code uint32) (*ProgramError, bool) {
+	for i := range p.idl.Errors {
+		if e := &p.idl.Errors[i]; e.Code == code {
+			return &ProgramError{Code: e.Code, Name: e.Name, Msg: e.Msg}, true
+		}
+	}
+	return LookupAnchorError(code)
+}
+
+// DecodeErrorMessage resolves the error code in messages such as
+// "custom program error: 0x1771", "Custom(6001)" or the JSON
+// {"Custom":6001} of a transaction's err.
+func (p *Parser) DecodeErrorMessage(msg string) (*ProgramError, bool) {
+	code, ok := parseCustomErrorCode(msg)
+	if !ok {
+		return nil, false
+	}
+	return p.DecodeErrorCode(code)
+}
+
+// DecodeErrorCode resolves the error code with the parser of the program,
+// falling back to the Anchor framework errors for unknown programs.
+func (r *Registry) DecodeErrorCode(programId string, code uint32) (*ProgramError, bool) {
+	if p, ok := r.Parser(programId); ok {
+		return p.DecodeErrorCode(code)
+	}
+	return LookupAnchorError(code)
+}
+
+var customErrorPattern = regexp.MustCompile(`(?:custom program error: (0x[0-9a-fA-F]+|\d+))|(?:Custom(?:\(|"\s*:\s*)(\d+))`)
+
+func parseCustomErrorCode(msg string) (uint32, bool) {
+	m := customErrorPattern.FindStringSubmatch(msg)
+	if m == nil {
+		return 0, false
+	}
+	raw := m[1]
+	if raw == "" {
+		raw = m[2]
+	}
+	// zero padded codes are decimal, not octal
+	base := 10
+	if hex, ok := strings.CutPrefix(raw, "0x"); ok {
+		raw, base = hex, 16
+	}
+	code, err := strconv.ParseUint(raw, base, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(code), true
+}
+
+var anchorErrorPattern = regexp.MustCompile(`^AnchorError (?:occurred|thrown in (.+):(\d+)|caused by account: (.+?))\. Error Code: (\w+)\. Error Number: (\d+)\. Error Message: (.*?)\.?$`)
+
+// ParseAnchorErrorLogs returns the last AnchorError logged in logs, with the
+// Left and Right values a failed require_* check logs after it.
+func ParseAnchorErrorLogs(logs []string) (*ProgramError, bool) {
+	msgs := make([]string, 0, len(logs))
+	for _, line := range logs {
+		if msg, ok := strings.CutPrefix(line, programLogPrefix); ok {
+			msgs = append(msgs, msg)
+		}
+	}
+	return parseAnchorErrorMessages(msgs)
+}
+
+// parseAnchorErrorMessages reads an AnchorError from "Program log:"
+// messages without their prefix.
+func parseAnchorErrorMessages(msgs []string) (*ProgramError, bool) {
+	var res *ProgramError
+	for i := 0; i < len(msgs); i++ {
+		if m := anchorErrorPattern.FindStringSubmatch(msgs[i]); m != nil {
+			code, err := strconv.ParseUint(m[5], 10, 32)
+			if err != nil {
+				continue
+			}
+			res = &ProgramError{Code: uint32(code), Name: m[4], Msg: m[6], Account: m[3]}
+			if m[1] != "" {
+				res.Origin = m[1] + ":" + m[2]
+			}
+			_, res.Anchor = anchorErrors[res.Code]
+			continue
+		}
+		if res == nil {
+			continue
+		}
+		// pubkeys are logged on the line after "Left:" and "Right:"
+		var value *string
+		rest, ok := strings.CutPrefix(msgs[i], "Left:")
+		if ok {
+			value = &res.Left
+		} else if rest, ok = strings.CutPrefix(msgs[i], "Right:"); ok {
+			value = &res.Right
+		} else {
+			continue
+		}
+		if rest = strings.TrimSpace(rest); rest != "" {
+			*value = rest
+		} else if i+1 < len(msgs) {
+			i++
+			*value = msgs[i]
+		}
+	}
+	return res, res != nil
+}
+
+// ParseErrorLogs returns the error a failed transaction's logs report when
+// this program raised it: the AnchorError it logged when there is one, else
+// the custom program error it failed with, resolved against the IDL. The
+// invoke stack decides which program raised the error, so errors of other
+// programs, including ones this program called, are not reported.
+func (p *Parser) ParseErrorLogs(logs []string) (*ProgramError, bool) {
+	invocation := failedInvocation(ParseTransactionLogs(logs).Invocations)
+	if invocation == nil {
+		return nil, false
+	}
+	if programId := p.idl.ProgramAddress(); programId != "" && invocation.ProgramId != programId {
+		return nil, false
+	}
+	if res, ok := parseAnchorErrorMessages(invocation.Logs); ok {
+		if e, ok := p.DecodeErrorCode(res.Code); ok && res.Msg == "" {
+			res.Msg = e.Msg
+		}
+		return res, true
+	}
+	return p.DecodeErrorMessage(invocation.Error)
+}
+
+// failedInvocation returns the invocation that raised a transaction's
+// error: the last, innermost one that failed or, when truncated logs lost
+// the result line, logged an AnchorError without succeeding.
+func failedInvocation(invocations []*ProgramInvocation) *ProgramInvocation {
+	for i := len(invocations) - 1; i >= 0; i-- {
+		invocation := invocations[i]
+		if res := failedInvocation(invocation.Invocations); res != nil {
+			return res
+		}
+		if invocation.Error != "" {
+			return invocation
+		}
+		if _, ok := parseAnchorErrorMessages(invocation.Logs); ok && !invocation.Success {
+			return invocation
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package anchor_idl_parser
+
+import "testing"
+
+const (
+	errorsProgram = "Errs111111111111111111111111111111111111111"
+	otherProgram  = "Othe111111111111111111111111111111111111111"
+)
+
+const errorsIdl = `{
+  "address": "` + errorsProgram + `",
+  "metadata": {"name": "errors", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [],
+  "errors": [
+    {"code": 6000, "name": "TooSmall", "msg": "Amount too small"},
+    {"code": 6001, "name": "Expired"}
+  ]
+}`
+
+func TestDecodeErrorCode(t *testing.T) {
+	p, err := NewParserWithJson(errorsIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		code   uint32
+		name   string
+		anchor bool
+	}{
+		{6000, "TooSmall", false},
+		{6001, "Expired", false},
+		{3012, "AccountNotInitialized", true},
+	}
+	for _, tt := range tests {
+		res, ok := p.DecodeErrorCode(tt.code)
+		if !ok || res.Name != tt.name || res.Anchor != tt.anchor {
+			t.Errorf("%d: got %+v", tt.code, res)
+		}
+	}
+	if res, ok := p.DecodeErrorCode(6002); ok {
+		t.Errorf("6002: got %+v", res)
+	}
+}
+
+func TestDecodeErrorMessage(t *testing.T) {
+	p, err := NewParserWithJson(errorsIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for msg, want := range map[string]uint32{
+		"custom program error: 0x1770":                    6000,
+		"custom program error: 6001":                      6001,
+		"custom program error: 06001":                     6001,
+		"Error processing Instruction 0: Custom(06000)":   6000,
+		`{"InstructionError":[0,{"Custom":6001}]}`:        6001,
+		`{"InstructionError": [1, {"Custom": 3012}]}`:     3012,
+		"Program failed: custom program error: 0x0000bc4": 3012,
+	} {
+		res, ok := p.DecodeErrorMessage(msg)
+		if !ok || res.Code != want {
+			t.Errorf("%q: got %+v, want %d", msg, res, want)
+		}
+	}
+	if res, ok := p.DecodeErrorMessage("insufficient funds"); ok {
+		t.Errorf("got %+v", res)
+	}
+}
+
+func TestParseAnchorErrorLogs(t *testing.T) {
+	res, ok := ParseAnchorErrorLogs([]string{
+		"Program " + errorsProgram + " invoke [1]",
+		"Program log: Instruction: Deposit",
+		"Program log: AnchorError caused by account: vault. Error Code: ConstraintSeeds. Error Number: 2006. Error Message: A seeds constraint was violated.",
+		"Program log: Left:",
+		"Program log: 11111111111111111111111111111111",
+		"Program log: Right:",
+		"Program log: SysvarRent111111111111111111111111111111111",
+		"Program " + errorsProgram + " failed: custom program error: 0x7d6",
+	})
+	want := ProgramError{
+		Code: 2006, Name: "ConstraintSeeds", Msg: "A seeds constraint was violated", Anchor: true, Account: "vault",
+		Left: "11111111111111111111111111111111", Right: "SysvarRent111111111111111111111111111111111",
+	}
+	if !ok || *res != want {
+		t.Errorf("got %+v, want %+v", res, want)
+	}
+
+	res, ok = ParseAnchorErrorLogs([]string{
+		"Program log: AnchorError thrown in programs/errors/src/lib.rs:42. Error Code: TooSmall. Error Number: 6000. Error Message: Amount too small.",
+		"Program log: Left: 1",
+		"Program log: Right: 2",
+	})
+	want = ProgramError{Code: 6000, Name: "TooSmall", Msg: "Amount too small", Origin: "programs/errors/src/lib.rs:42", Left: "1", Right: "2"}
+	if !ok || *res != want {
+		t.Errorf("got %+v, want %+v", res, want)
+	}
+}
+
+func TestParseErrorLogs(t *testing.T) {
+	p, err := NewParserWithJson(errorsIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoke := func(programId string, depth string) string {
+		return "Program " + programId + " invoke [" + depth + "]"
+	}
+	anchorError := func(code, name string) string {
+		return "Program log: AnchorError occurred. Error Code: " + name + ". Error Number: " + code + ". Error Message: ."
+	}
+	tests := []struct {
+		name string
+		logs []string
+		// code is 0 when no error of this program is expected
+		code uint32
+		msg  string
+	}{
+		{
+			name: "anchor error",
+			logs: []string{
+				invoke(errorsProgram, "1"),
+				anchorError("6000", "TooSmall"),
+				"Program " + errorsProgram + " failed: custom program error: 0x1770",
+			},
+			code: 6000, msg: "Amount too small",
+		},
+		{
+			name: "custom error",
+			logs: []string{
+				invoke(errorsProgram, "1"),
+				"Program " + errorsProgram + " consumed 1200 of 200000 compute units",
+				"Program " + errorsProgram + " failed: custom program error: 0x1771",
+			},
+			code: 6001,
+		},
+		{
+			name: "error of a called program",
+			logs: []string{
+				invoke(errorsProgram, "1"),
+				invoke(otherProgram, "2"),
+				anchorError("6000", "Other"),
+				"Program " + otherProgram + " failed: custom program error: 0x1770",
+				"Program " + errorsProgram + " failed: custom program error: 0x1770",
+			},
+		},
+		{
+			name: "error of a later instruction",
+			logs: []string{
+				invoke(errorsProgram, "1"),
+				anchorError("6001", "Expired"),
+				"Program " + errorsProgram + " success",
+				invoke(otherProgram, "1"),
+				"Program " + otherProgram + " failed: custom program error: 0x1770",
+			},
+		},
+		{
+			name: "error after a successful call",
+			logs: []string{
+				invoke(errorsProgram, "1"),
+				invoke(otherProgram, "2"),
+				"Program " + otherProgram + " success",
+				"Program " + errorsProgram + " failed: custom program error: 0x1771",
+			},
+			code: 6001,
+		},
+		{
+			name: "truncated",
+			logs: []string{
+				invoke(errorsProgram, "1"),
+				anchorError("6000", "TooSmall"),
+				logTruncated,
+			},
+			code: 6000, msg: "Amount too small",
+		},
+	}
+	for _, tt := range tests {
+		res, ok := p.ParseErrorLogs(tt.logs)
+		if tt.code == 0 {
+			if ok {
+				t.Errorf("%s: got %+v", tt.name, res)
+			}
+			continue
+		}
+		if !ok || res.Code != tt.code || (tt.msg != "" && res.Msg != tt.msg) {
+			t.Errorf("%s: got %+v, want %d %q", tt.name, res, tt.code, tt.msg)
+		}
+	}
+}
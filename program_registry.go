@@ -0,0 +1,133 @@
+package anchor_idl_parser
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry routes decoding to the parser of a program by program ID. It is
+// safe for concurrent use, and parsers can be replaced while decoding runs,
+// e.g. to reload an upgraded IDL.
+type Registry struct {
+	mu      sync.RWMutex
+	parsers map[string]*Parser
+}
+
+func NewRegistry() *Registry {
+	return &Registry{parsers: make(map[string]*Parser)}
+}
+
+// Add registers the parser under the program address of its IDL, replacing
+// any parser registered for that program.
+func (r *Registry) Add(p *Parser) error {
+	programId := p.GetIdl().ProgramAddress()
+	if programId == "" {
+		return fmt.Errorf("%w: %s has no program address", ErrInvalidIdl, p.GetIdl().ProgramName())
+	}
+	r.AddWithProgramId(programId, p)
+	return nil
+}
+
+// AddWithProgramId registers the parser under programId, for IDLs without an
+// address or programs deployed at a different address.
+func (r *Registry) AddWithProgramId(programId string, p *Parser) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.parsers[programId] = p
+}
+
+// AddPath loads the IDL file and registers it like Add.
+func (r *Registry) AddPath(idlPath string) (*Parser, error) {
+	p, err := NewParserWithPath(idlPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Add(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// AddJson parses the IDL JSON and registers it like Add.
+func (r *Registry) AddJson(idlJson string) (*Parser, error) {
+	p, err := NewParserWithJson(idlJson)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Add(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Remove drops the parser of the program and reports whether there was one.
+func (r *Registry) Remove(programId string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.parsers[programId]
+	delete(r.parsers, programId)
+	return ok
+}
+
+func (r *Registry) Parser(programId string) (*Parser, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.parsers[programId]
+	return p, ok
+}
+
+// ProgramIds returns the registered program IDs in sorted order.
+func (r *Registry) ProgramIds() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]string, 0, len(r.parsers))
+	for programId := range r.parsers {
+		res = append(res, programId)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.parsers)
+}
+
+func (r *Registry) parser(programId string) (*Parser, error) {
+	p, ok := r.Parser(programId)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrProgramNotFound, programId)
+	}
+	return p, nil
+}
+
+// DecodeInstruction decodes instruction data of the program like
+// InstructionParse.
+func (r *Registry) DecodeInstruction(programId string, data []byte) (map[string]interface{}, error) {
+	p, err := r.parser(programId)
+	if err != nil {
+		return nil, err
+	}
+	return p.InstructionParse(data)
+}
+
+// DecodeAccount decodes account data owned by the program like AccountsParse.
+func (r *Registry) DecodeAccount(owner string, data []byte) (map[string]interface{}, error) {
+	p, err := r.parser(owner)
+	if err != nil {
+		return nil, err
+	}
+	return p.AccountsParse(data)
+}
+
+// DecodeLog decodes a "Program data:" log line emitted by the program like
+// EventParse.
+func (r *Registry) DecodeLog(programId string, line string) (map[string]interface{}, error) {
+	p, err := r.parser(programId)
+	if err != nil {
+		return nil, err
+	}
+	return p.EventParse(line)
+}
@@ -0,0 +1,163 @@
+package anchor_idl_parser
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+const (
+	registryProgramA = "ProgA111111111111111111111111111111111111111"
+	registryProgramB = "ProgB111111111111111111111111111111111111111"
+)
+
+// registryProgramIdl has the same discriminators for every program, so only
+// routing tells the u8 and u16 layouts apart.
+func registryProgramIdl(address string, valueType string) string {
+	return fmt.Sprintf(`{
+  "address": %q,
+  "metadata": {"name": "registry", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "set", "discriminator": [1, 0, 0, 0, 0, 0, 0, 0], "accounts": [], "args": [{"name": "v", "type": %q}]}
+  ],
+  "accounts": [{"name": "State", "discriminator": [2]}],
+  "events": [{"name": "Changed", "discriminator": [3]}],
+  "types": [
+    {"name": "State", "type": {"kind": "struct", "fields": [{"name": "v", "type": %[2]q}]}},
+    {"name": "Changed", "type": {"kind": "struct", "fields": [{"name": "v", "type": %[2]q}]}}
+  ]
+}`, address, valueType)
+}
+
+// setData is the data of the set instruction of registryProgramIdl.
+func setData(payload ...byte) []byte {
+	return append([]byte{1, 0, 0, 0, 0, 0, 0, 0}, payload...)
+}
+
+func newTestRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r := NewRegistry()
+	if _, err := r.AddJson(registryProgramIdl(registryProgramA, "u8")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.AddJson(registryProgramIdl(registryProgramB, "u16")); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRegistryRouting(t *testing.T) {
+	r := newTestRegistry(t)
+	if got := r.ProgramIds(); !reflect.DeepEqual(got, []string{registryProgramA, registryProgramB}) || r.Len() != 2 {
+		t.Errorf("got %v", got)
+	}
+	tests := []struct {
+		programId string
+		want      interface{}
+	}{
+		{registryProgramA, uint8(1)},
+		{registryProgramB, uint16(0x0201)},
+	}
+	for _, tt := range tests {
+		res, err := r.DecodeInstruction(tt.programId, setData(1, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res["data"].(map[string]interface{})["v"]; got != tt.want {
+			t.Errorf("instruction of %s: got %v, want %v", tt.programId, got, tt.want)
+		}
+		res, err = r.DecodeAccount(tt.programId, []byte{2, 1, 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res["data"].(map[string]interface{})["v"]; got != tt.want {
+			t.Errorf("account of %s: got %v, want %v", tt.programId, got, tt.want)
+		}
+		res, err = r.DecodeLog(tt.programId, "Program data: AwEC")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res["data"].(map[string]interface{})["v"]; got != tt.want {
+			t.Errorf("event of %s: got %v, want %v", tt.programId, got, tt.want)
+		}
+	}
+
+	unknown := "Unkn111111111111111111111111111111111111111"
+	if _, err := r.DecodeInstruction(unknown, setData(1)); !errors.Is(err, ErrProgramNotFound) {
+		t.Errorf("got %v, want ErrProgramNotFound", err)
+	}
+	if _, err := r.DecodeAccount(unknown, []byte{2, 1}); !errors.Is(err, ErrProgramNotFound) {
+		t.Errorf("got %v, want ErrProgramNotFound", err)
+	}
+	if _, err := r.DecodeLog(unknown, "Program data: AwEC"); !errors.Is(err, ErrProgramNotFound) {
+		t.Errorf("got %v, want ErrProgramNotFound", err)
+	}
+
+	// a program deployed at another address
+	p, _ := r.Parser(registryProgramB)
+	r.AddWithProgramId(unknown, p)
+	if _, err := r.DecodeInstruction(unknown, setData(1, 2)); err != nil {
+		t.Error(err)
+	}
+	if !r.Remove(unknown) || r.Remove(unknown) {
+		t.Error("Remove does not report the registered parser")
+	}
+	if _, err := r.DecodeInstruction(unknown, setData(1, 2)); !errors.Is(err, ErrProgramNotFound) {
+		t.Errorf("got %v, want ErrProgramNotFound", err)
+	}
+}
+
+func TestRegistryAddWithoutAddress(t *testing.T) {
+	p, err := NewParserWithJson(`{
+  "metadata": {"name": "anonymous", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": []
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewRegistry().Add(p); !errors.Is(err, ErrInvalidIdl) {
+		t.Errorf("got %v, want ErrInvalidIdl", err)
+	}
+}
+
+// TestRegistryConcurrentAddRemove replaces and removes parsers while other
+// goroutines decode, run it with -race.
+func TestRegistryConcurrentAddRemove(t *testing.T) {
+	r := newTestRegistry(t)
+	replacement, err := NewParserWithJson(registryProgramIdl(registryProgramA, "u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				res, err := r.DecodeInstruction(registryProgramA, setData(1))
+				if errors.Is(err, ErrProgramNotFound) {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got := res["data"].(map[string]interface{})["v"]; got != uint8(1) {
+					t.Errorf("got %v", got)
+					return
+				}
+				r.ProgramIds()
+			}
+		}()
+	}
+	for j := 0; j < 200; j++ {
+		if j%2 == 0 {
+			r.Remove(registryProgramA)
+		} else if err := r.Add(replacement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
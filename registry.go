@@ -0,0 +1,204 @@
+package anchor_idl_parser
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PrimitiveHandler decodes and encodes a custom fixed size primitive, for
+// IDLs that reference primitive names this package does not know.
+type PrimitiveHandler struct {
+	Size   int
+	Decode func(b []byte) (interface{}, error)
+	// Encode is optional, encoding the primitive fails without it.
+	Encode func(value interface{}) ([]byte, error)
+}
+
+var (
+	primitiveHandlersMu sync.RWMutex
+	primitiveHandlers   = make(map[string]PrimitiveHandler)
+)
+
+// RegisterPrimitive adds a handler for the primitive type name, used by every
+// Parser. Built-in primitives cannot be replaced.
+func RegisterPrimitive(name string, handler PrimitiveHandler) error {
+	if name == "" || handler.Size <= 0 || handler.Decode == nil {
+		return fmt.Errorf("%w: primitive %q needs a name, a positive size and a decoder", ErrInvalidValue, name)
+	}
+	if _, ok := primitiveSizes[name]; ok || name == "string" || name == "bytes" {
+		return fmt.Errorf("%w: %s is a built-in primitive", ErrInvalidValue, name)
+	}
+	primitiveHandlersMu.Lock()
+	defer primitiveHandlersMu.Unlock()
+	primitiveHandlers[name] = handler
+	typeHandlersVersion.Add(1)
+	return nil
+}
+
+func lookupPrimitive(name string) (PrimitiveHandler, bool) {
+	primitiveHandlersMu.RLock()
+	defer primitiveHandlersMu.RUnlock()
+	handler, ok := primitiveHandlers[name]
+	return handler, ok
+}
+
+// TypeHandler decodes and encodes a defined type by name, for well-known
+// external types such as fixed point decimals whose raw layout is not useful
+// to callers.
+type TypeHandler struct {
+	// Size is the encoded size in bytes, or 0 when the size is variable.
+	Size int
+	// Decode returns the value and the number of bytes it consumed.
+	Decode func(data []byte) (interface{}, int, error)
+	// Encode is optional, encoding the type fails without it.
+	Encode func(value interface{}) ([]byte, error)
+}
+
+var (
+	typeHandlersMu sync.RWMutex
+	typeHandlers   = make(map[string]TypeHandler)
+)
+
+func checkTypeHandler(name string, handler TypeHandler) error {
+	if name == "" || handler.Size < 0 || handler.Decode == nil {
+		return fmt.Errorf("%w: type %q needs a name, a non negative size and a decoder", ErrInvalidValue, name)
+	}
+	return nil
+}
+
+// RegisterType adds a handler for the defined type name, used by every Parser
+// whose IDL does not define a type of that name itself.
+func RegisterType(name string, handler TypeHandler) error {
+	if err := checkTypeHandler(name, handler); err != nil {
+		return err
+	}
+	typeHandlersMu.Lock()
+	defer typeHandlersMu.Unlock()
+	typeHandlers[name] = handler
+	typeHandlersVersion.Add(1)
+	return nil
+}
+
+// RegisterType adds a handler for the defined type name to this parser. It
+// takes precedence over the IDL definition and over global handlers, and may
+// be called while the parser decodes.
+func (p *Parser) RegisterType(name string, handler TypeHandler) error {
+	if err := checkTypeHandler(name, handler); err != nil {
+		return err
+	}
+	p.handlersMu.Lock()
+	defer p.handlersMu.Unlock()
+	// copy on write, compiled envs keep the map they were built from
+	handlers := make(map[string]TypeHandler, len(p.typeHandlers)+1)
+	for k, v := range p.typeHandlers {
+		handlers[k] = v
+	}
+	handlers[name] = handler
+	p.typeHandlers = handlers
+	p.compiled.Store(compileTypeEnv(p.idl, p.typeHandlers))
+	return nil
+}
+
+// NewScaledDecimalHandler returns a handler for a type stored as the integer
+// primitive scaled by 10^scale, e.g. a u64 with scale 6 for token amounts.
+// Values are decoded to decimal strings such as "12.500000" and encoded from
+// decimal strings or numbers.
+func NewScaledDecimalHandler(primitive string, scale int) (TypeHandler, error) {
+	size, ok := primitiveSizes[primitive]
+	if !ok || primitive == "bool" || primitive == "f32" || primitive == "f64" || primitive == "pubkey" || primitive == "publicKey" {
+		return TypeHandler{}, fmt.Errorf("%w: %s is not an integer primitive", ErrInvalidValue, primitive)
+	}
+	if scale < 0 {
+		return TypeHandler{}, fmt.Errorf("%w: negative scale %d", ErrInvalidValue, scale)
+	}
+	signed := primitive[0] == 'i'
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	return TypeHandler{
+		Size: size,
+		Decode: func(data []byte) (interface{}, int, error) {
+			if len(data) < size {
+				return nil, 0, ErrTruncatedData
+			}
+			return formatScaled(littleEndianBigInt(data[:size], signed), scale), size, nil
+		},
+		Encode: func(value interface{}) ([]byte, error) {
+			n, err := parseScaled(value, unit, scale)
+			if err != nil {
+				return nil, err
+			}
+			return appendInteger(nil, n, size, signed, "")
+		},
+	}, nil
+}
+
+func formatScaled(n *big.Int, scale int) string {
+	if scale == 0 {
+		return n.String()
+	}
+	digits := new(big.Int).Abs(n).String()
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	res := digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	if n.Sign() < 0 {
+		res = "-" + res
+	}
+	return res
+}
+
+func parseScaled(value interface{}, unit *big.Int, scale int) (*big.Int, error) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case fmt.Stringer:
+		s = v.String()
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		n, err := toBigInt(value)
+		if err != nil {
+			return nil, err
+		}
+		return n.Mul(n, unit), nil
+	}
+	if !isDecimal(s) {
+		// integers may still be given in hex
+		n, ok := parseInteger(s)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a decimal", s)
+		}
+		return n.Mul(n, unit), nil
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a decimal", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt(unit))
+	if !r.IsInt() {
+		return nil, fmt.Errorf("%q has more than %d decimals", s, scale)
+	}
+	return r.Num(), nil
+}
+
+// isDecimal reports whether s is a plain base 10 number such as "-12.50",
+// which big.Rat would otherwise also accept as a fraction, with a base
+// prefix or with an exponent.
+func isDecimal(s string) bool {
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return false
+	}
+	for _, c := range whole + frac {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
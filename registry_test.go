@@ -0,0 +1,177 @@
+package anchor_idl_parser
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+)
+
+const registryIdl = `{
+  "address": "Regi111111111111111111111111111111111111111",
+  "metadata": {"name": "registry", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "set", "discriminator": [1], "accounts": [],
+     "args": [{"name": "price", "type": {"defined": {"name": "Price"}}}, {"name": "flag", "type": "u8"}]}
+  ]
+}`
+
+func TestTypeHandlerEncodeSize(t *testing.T) {
+	p, err := NewParserWithJson(registryIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := NewScaledDecimalHandler("u64", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RegisterType("Price", handler); err != nil {
+		t.Fatal(err)
+	}
+	args := map[string]interface{}{"price": "1.5", "flag": uint8(7)}
+	data, err := p.InstructionEncode("set", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := p.InstructionParse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := res["data"].(map[string]interface{})
+	if values["price"] != "1.500000" || values["flag"] != uint8(7) {
+		t.Errorf("got %v", values)
+	}
+
+	short := handler
+	short.Encode = func(value interface{}) ([]byte, error) {
+		return []byte{1}, nil
+	}
+	if err := p.RegisterType("Price", short); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.InstructionEncode("set", args); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("got %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestRegisterPrimitiveAfterParser(t *testing.T) {
+	p, err := NewParserWithJson(`{
+  "address": "Regi111111111111111111111111111111111111111",
+  "metadata": {"name": "registry", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [],
+  "accounts": [{"name": "A", "discriminator": [1]}, {"name": "B", "discriminator": [2]}],
+  "types": [
+    {"name": "A", "type": {"kind": "struct", "fields": [{"name": "a", "type": "fx4"}]}},
+    {"name": "B", "serialization": "bytemuck", "repr": {"kind": "c"},
+     "type": {"kind": "struct", "fields": [{"name": "a", "type": "fx4"}]}}
+  ]
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.AccountSize("B"); ok {
+		t.Fatal("fx4 has a size before it is registered")
+	}
+	err = RegisterPrimitive("fx4", PrimitiveHandler{
+		Size: 4,
+		Decode: func(b []byte) (interface{}, error) {
+			return binary.LittleEndian.Uint32(b), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"A", "B"} {
+		if size, ok := p.AccountSize(name); !ok || size != 5 {
+			t.Errorf("%s: got size %d %v, want 5", name, size, ok)
+		}
+	}
+	for _, data := range [][]byte{{1, 7, 0, 0, 0}, {2, 7, 0, 0, 0}} {
+		res, err := p.AccountsParse(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res["data"].(map[string]interface{})["a"]; got != uint32(7) {
+			t.Errorf("account %d: got %v, want 7", data[0], got)
+		}
+	}
+}
+
+func TestScaledDecimalStrings(t *testing.T) {
+	handler, err := NewScaledDecimalHandler("u64", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for value, want := range map[string]uint64{"010.5": 1050, "0x10": 1600, "3": 300, ".25": 25} {
+		b, err := handler.Encode(value)
+		if err != nil {
+			t.Errorf("%q: %v", value, err)
+			continue
+		}
+		if got := binary.LittleEndian.Uint64(b); got != want {
+			t.Errorf("%q: got %d, want %d", value, got, want)
+		}
+	}
+	for _, value := range []string{"0b1", "1/2", "1e2", "1_0", "0x1.8"} {
+		if _, err := handler.Encode(value); err == nil {
+			t.Errorf("%q: encoded", value)
+		}
+	}
+}
+
+func TestRegisterTypeWhileDecoding(t *testing.T) {
+	p, err := NewParserWithJson(registryIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := NewScaledDecimalHandler("u64", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RegisterType("Price", handler); err != nil {
+		t.Fatal(err)
+	}
+	data, err := p.InstructionEncode("set", map[string]interface{}{"price": "1.5", "flag": uint8(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	registered := make(chan error)
+	go func() {
+		for {
+			select {
+			case <-done:
+				registered <- nil
+				return
+			default:
+			}
+			if err := p.RegisterType("Price", handler); err != nil {
+				registered <- err
+				return
+			}
+			// bumps the version so decoders recompile concurrently
+			if err := RegisterType("RaceUnused", handler); err != nil {
+				registered <- err
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if _, err := p.InstructionParse(data); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	if err := <-registered; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,141 @@
+package anchor_idl_parser
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const programReturnPrefix = "Program return: "
+
+// maxReturnDataLength is the runtime's MAX_RETURN_DATA.
+const maxReturnDataLength = 1024
+
+// ReturnData is the data an instruction set with set_return_data.
+type ReturnData struct {
+	ProgramId string
+	Data      []byte
+}
+
+// SimulationReturnData is the returnData of a simulateTransaction result or
+// of a transaction's meta, whose data is a [base64 payload, "base64"] pair.
+type SimulationReturnData struct {
+	ProgramId string   `json:"programId"`
+	Data      []string `json:"data"`
+}
+
+// ReturnData decodes the base64 payload.
+func (s *SimulationReturnData) ReturnData() (*ReturnData, error) {
+	if len(s.Data) == 0 {
+		return &ReturnData{ProgramId: s.ProgramId}, nil
+	}
+	if len(s.Data) > 1 && s.Data[1] != "base64" {
+		return nil, fmt.Errorf("%w: return data encoding %s", ErrInvalidValue, s.Data[1])
+	}
+	data, err := base64.StdEncoding.DecodeString(s.Data[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: return data: %v", ErrInvalidValue, err)
+	}
+	return &ReturnData{ProgramId: s.ProgramId, Data: data}, nil
+}
+
+// ParseReturnDataLog reads a "Program return: <program id> <base64>" line.
+func ParseReturnDataLog(line string) (*ReturnData, error) {
+	rest, ok := strings.CutPrefix(line, programReturnPrefix)
+	if !ok {
+		return nil, fmt.Errorf("%w: not a return data line", ErrInvalidLog)
+	}
+	programId, payload, _ := strings.Cut(rest, " ")
+	if programId == "" {
+		return nil, fmt.Errorf("%w: return data without program id", ErrInvalidLog)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(payload))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid base64: %v", ErrInvalidLog, err)
+	}
+	return &ReturnData{ProgramId: programId, Data: data}, nil
+}
+
+// DecodeReturnData decodes the return data of the named instruction with its
+// IDL returns type, as set_return_data stored and "Program return:" logs it.
+func (p *Parser) DecodeReturnData(instructionName string, data []byte) (interface{}, error) {
+	return p.decodeReturnData(instructionName, data, false)
+}
+
+// decodeReturnData decodes return data, zero padding data whose trailing
+// zero bytes the runtime stripped, as it does for the returnData of
+// simulation and transaction results.
+func (p *Parser) decodeReturnData(instructionName string, data []byte, trimmed bool) (interface{}, error) {
+	instruction, plan := p.instructionPlan(instructionName)
+	if instruction == nil {
+		return nil, fmt.Errorf("%w: %s", ErrInstructionNotFound, instructionName)
+	}
+	if instruction.Returns == nil {
+		return nil, fmt.Errorf("%w: %s returns nothing", ErrTypeNotFound, instructionName)
+	}
+	value := data
+	if trimmed && len(data) < maxReturnDataLength {
+		value = make([]byte, maxReturnDataLength)
+		copy(value, data)
+	}
+	ctx := p.newDecodeContext()
+	ctx.pushField("returns")
+	val, n := extractValue(value, ctx, 0, plan.returns)
+	if n < len(data) {
+		ctx.path = ctx.path[:0]
+		ctx.failStrict(n, ErrTrailingData, "%d bytes left after the return value", len(data)-n)
+	}
+	if ctx.err != nil {
+		ctx.err.Kind = ItemKindInstruction
+		ctx.err.Name = instructionName
+		return nil, ctx.err
+	}
+	return val, nil
+}
+
+// DecodeReturnDataLogs decodes the last return data this parser's program
+// logged as the return value of the named instruction.
+func (p *Parser) DecodeReturnDataLogs(instructionName string, logs []string) (interface{}, error) {
+	programId := p.idl.ProgramAddress()
+	for i := len(logs) - 1; i >= 0; i-- {
+		if !strings.HasPrefix(logs[i], programReturnPrefix) {
+			continue
+		}
+		returnData, err := ParseReturnDataLog(logs[i])
+		if err != nil {
+			return nil, err
+		}
+		if programId == "" || returnData.ProgramId == programId {
+			return p.DecodeReturnData(instructionName, returnData.Data)
+		}
+	}
+	return nil, fmt.Errorf("%w: no return data", ErrInvalidLog)
+}
+
+// DecodeSimulationReturnData decodes the returnData of a simulation or
+// transaction result as the return value of the named instruction. The
+// runtime strips trailing zero bytes from it, so missing bytes decode as
+// zeros.
+func (p *Parser) DecodeSimulationReturnData(instructionName string, returnData *SimulationReturnData) (interface{}, error) {
+	if returnData == nil {
+		return nil, fmt.Errorf("%w: no return data", ErrInvalidValue)
+	}
+	if programId := p.idl.ProgramAddress(); programId != "" && returnData.ProgramId != programId {
+		return nil, fmt.Errorf("%w: return data of %s", ErrInvalidValue, returnData.ProgramId)
+	}
+	res, err := returnData.ReturnData()
+	if err != nil {
+		return nil, err
+	}
+	return p.decodeReturnData(instructionName, res.Data, true)
+}
+
+// DecodeReturnData decodes the return data of the program's named
+// instruction like Parser.DecodeReturnData.
+func (r *Registry) DecodeReturnData(programId string, instructionName string, data []byte) (interface{}, error) {
+	p, err := r.parser(programId)
+	if err != nil {
+		return nil, err
+	}
+	return p.DecodeReturnData(instructionName, data)
+}
@@ -0,0 +1,52 @@
+package anchor_idl_parser
+
+import (
+	"errors"
+	"testing"
+)
+
+const returnDataIdl = `{
+  "address": "Ret1111111111111111111111111111111111111111",
+  "metadata": {"name": "return_data", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "quote", "discriminator": [1], "accounts": [], "args": [], "returns": "u64"}
+  ]
+}`
+
+func TestDecodeReturnData(t *testing.T) {
+	p, err := NewParserWithJson(returnDataIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetStrict(true)
+
+	if val, err := p.DecodeReturnData("quote", []byte{0x40, 0x42, 0x0f, 0, 0, 0, 0, 0}); err != nil || val != uint64(1000000) {
+		t.Errorf("got %v %v", val, err)
+	}
+	// a u32 where a u64 is declared
+	if _, err := p.DecodeReturnData("quote", []byte{0x40, 0x42, 0x0f, 0}); !errors.Is(err, ErrTruncatedData) {
+		t.Errorf("got %v, want ErrTruncatedData", err)
+	}
+	if _, err := p.DecodeReturnData("quote", make([]byte, 9)); !errors.Is(err, ErrTrailingData) {
+		t.Errorf("got %v, want ErrTrailingData", err)
+	}
+
+	logs := []string{
+		"Program Ret1111111111111111111111111111111111111111 invoke [1]",
+		"Program return: Ret1111111111111111111111111111111111111111 QEIPAA==",
+		"Program Ret1111111111111111111111111111111111111111 success",
+	}
+	if _, err := p.DecodeReturnDataLogs("quote", logs); !errors.Is(err, ErrTruncatedData) {
+		t.Errorf("got %v, want ErrTruncatedData", err)
+	}
+
+	// the runtime strips trailing zeros from simulation return data
+	sim := &SimulationReturnData{ProgramId: "Ret1111111111111111111111111111111111111111", Data: []string{"QEIP", "base64"}}
+	if val, err := p.DecodeSimulationReturnData("quote", sim); err != nil || val != uint64(1000000) {
+		t.Errorf("got %v %v", val, err)
+	}
+	sim.ProgramId = "Other111111111111111111111111111111111111111"
+	if _, err := p.DecodeSimulationReturnData("quote", sim); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("got %v, want ErrInvalidValue", err)
+	}
+}
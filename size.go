@@ -0,0 +1,151 @@
+package anchor_idl_parser
+
+var primitiveSizes = map[string]int{
+	"bool":      1,
+	"u8":        1,
+	"i8":        1,
+	"u16":       2,
+	"i16":       2,
+	"u32":       4,
+	"i32":       4,
+	"f32":       4,
+	"u64":       8,
+	"i64":       8,
+	"f64":       8,
+	"u128":      16,
+	"i128":      16,
+	"u256":      32,
+	"i256":      32,
+	"pubkey":    32,
+	"publicKey": 32,
+}
+
+// maxFixedSize is the largest account Solana allows, fixed sizes above it
+// can only come from a broken IDL and are treated as unknown.
+const maxFixedSize = 10 * 1024 * 1024
+
+func isBuiltinPrimitive(argType string) bool {
+	if _, ok := primitiveSizes[argType]; ok {
+		return true
+	}
+	return argType == "string" || argType == "bytes"
+}
+
+func primitiveSize(argType string) (int, bool) {
+	if size, ok := primitiveSizes[argType]; ok {
+		return size, true
+	}
+	if handler, ok := lookupPrimitive(argType); ok {
+		return handler.Size, true
+	}
+	return 0, false
+}
+
+// fixedSizeOf returns the Borsh encoded size of argType when it does not
+// depend on the value, and false for variable sized types such as vec,
+// string or option.
+func fixedSizeOf(env *typeEnv, argType *IdlType) (int, bool) {
+	return fixedSizeOfWithDepth(env, argType, 0)
+}
+
+func fixedSizeOfWithDepth(env *typeEnv, argType *IdlType, depth int) (int, bool) {
+	if depth > maxRecursiveDepth {
+		return 0, false
+	}
+	switch {
+	case argType.Primitive != "":
+		return primitiveSize(argType.Primitive)
+	case argType.COption != nil:
+		size, ok := fixedSizeOfWithDepth(env, argType.COption, depth+1)
+		if !ok {
+			return 0, false
+		}
+		return 4 + size, true
+	case argType.Array != nil:
+		if argType.Array.Len.Generic != "" {
+			return 0, false
+		}
+		size, ok := fixedSizeOfWithDepth(env, &argType.Array.Elem, depth+1)
+		if !ok || (size > 0 && argType.Array.Len.Value > maxFixedSize/size) {
+			return 0, false
+		}
+		return size * argType.Array.Len.Value, true
+	case argType.Defined != nil:
+		if handler, ok := env.lookupType(argType.Defined.Name); ok {
+			return handler.Size, handler.Size > 0
+		}
+		key := definedKey(argType.Defined)
+		if cached, ok := env.sizes.Load(key); ok {
+			return cached.(fixedSize).size, cached.(fixedSize).ok
+		}
+		typeData, err := env.resolve(argType.Defined)
+		if err != nil {
+			return 0, false
+		}
+		size, ok := fixedSizeOfTypeDefWithDepth(env, typeData, depth+1)
+		env.sizes.Store(key, fixedSize{size: size, ok: ok})
+		return size, ok
+	}
+	return 0, false
+}
+
+func fixedSizeOfTypeDefWithDepth(env *typeEnv, typeData *IdlTypeDefTy, depth int) (int, bool) {
+	if depth > maxRecursiveDepth {
+		return 0, false
+	}
+	switch typeData.Kind {
+	case IdlTypeDefKindType:
+		if typeData.Alias == nil {
+			return 0, false
+		}
+		return fixedSizeOfWithDepth(env, typeData.Alias, depth+1)
+	case IdlTypeDefKindStruct:
+		return fixedSizeOfFieldsWithDepth(env, typeData.Fields, depth+1)
+	case IdlTypeDefKindEnum:
+		// a borsh enum only has a fixed size when every variant has the same size
+		size := -1
+		for i := range typeData.Variants {
+			variantSize, ok := fixedSizeOfFieldsWithDepth(env, typeData.Variants[i].Fields, depth+1)
+			if !ok || (size >= 0 && size != variantSize) {
+				return 0, false
+			}
+			size = variantSize
+		}
+		if size < 0 {
+			size = 0
+		}
+		return 1 + size, true
+	}
+	return 0, false
+}
+
+func fixedSizeOfFieldsWithDepth(env *typeEnv, fields *IdlDefinedFields, depth int) (int, bool) {
+	if fields == nil {
+		return 0, true
+	}
+	size := 0
+	if fields.IsTuple() {
+		for i := range fields.Tuple {
+			n, ok := fixedSizeOfWithDepth(env, &fields.Tuple[i], depth)
+			if !ok {
+				return 0, false
+			}
+			size += n
+			if size > maxFixedSize {
+				return 0, false
+			}
+		}
+		return size, true
+	}
+	for i := range fields.Named {
+		n, ok := fixedSizeOfWithDepth(env, &fields.Named[i].Type, depth)
+		if !ok {
+			return 0, false
+		}
+		size += n
+		if size > maxFixedSize {
+			return 0, false
+		}
+	}
+	return size, true
+}
@@ -0,0 +1,67 @@
+package utils
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58Word is 58^5, the largest power of 58 a 32 bit word division by a
+// 64 bit remainder can take.
+const base58Word = 58 * 58 * 58 * 58 * 58
+
+// EncodeBase58 encodes b like base58.Encode of btcutil, dividing 32 bit
+// words instead of a big.Int, which is several times faster for pubkeys.
+func EncodeBase58(b []byte) string {
+	zeros := 0
+	for zeros < len(b) && b[zeros] == 0 {
+		zeros++
+	}
+	rest := b[zeros:]
+
+	// pubkeys fit the stack buffers
+	var wordBuf [8]uint32
+	var digitBuf [48]byte
+	var words []uint32
+	if n := (len(rest) + 3) / 4; n <= len(wordBuf) {
+		words = wordBuf[:n]
+	} else {
+		words = make([]uint32, n)
+	}
+	digits := digitBuf[:0]
+
+	// big endian words, the last byte in the low bits of the last word
+	for i, c := range rest {
+		pos := len(rest) - 1 - i
+		words[len(words)-1-pos/4] |= uint32(c) << (8 * (pos % 4))
+	}
+	for start := 0; start < len(words); {
+		var rem uint64
+		for i := start; i < len(words); i++ {
+			cur := rem<<32 | uint64(words[i])
+			words[i] = uint32(cur / base58Word)
+			rem = cur % base58Word
+		}
+		for start < len(words) && words[start] == 0 {
+			start++
+		}
+		for j := 0; j < 5; j++ {
+			digits = append(digits, byte(rem%58))
+			rem /= 58
+		}
+	}
+	for len(digits) > 0 && digits[len(digits)-1] == 0 {
+		digits = digits[:len(digits)-1]
+	}
+
+	var resBuf [64]byte
+	var res []byte
+	if n := zeros + len(digits); n <= len(resBuf) {
+		res = resBuf[:n]
+	} else {
+		res = make([]byte, n)
+	}
+	for i := 0; i < zeros; i++ {
+		res[i] = '1'
+	}
+	for i, d := range digits {
+		res[len(res)-1-i] = base58Alphabet[d]
+	}
+	return string(res)
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+func TestEncodeBase58(t *testing.T) {
+	inputs := [][]byte{
+		nil,
+		{0},
+		{0, 0, 0},
+		{0, 0, 1},
+		{57},
+		{58},
+		make([]byte, 32),
+	}
+	max := make([]byte, 32)
+	for i := range max {
+		max[i] = 0xff
+	}
+	inputs = append(inputs, max)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		b := make([]byte, r.Intn(80))
+		r.Read(b)
+		for j := 0; j < len(b) && r.Intn(4) == 0; j++ {
+			b[j] = 0
+		}
+		inputs = append(inputs, b)
+	}
+	for _, b := range inputs {
+		if got, want := EncodeBase58(b), base58.Encode(b); got != want {
+			t.Errorf("%x: got %s, want %s", b, got, want)
+		}
+	}
+	// the system program
+	if got := EncodeBase58(make([]byte, 32)); got != "11111111111111111111111111111111" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func BenchmarkEncodeBase58(b *testing.B) {
+	key := make([]byte, 32)
+	rand.New(rand.NewSource(1)).Read(key)
+	b.Run("words", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			EncodeBase58(key)
+		}
+	})
+	b.Run("btcutil", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			base58.Encode(key)
+		}
+	})
+}
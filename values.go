@@ -0,0 +1,122 @@
+package anchor_idl_parser
+
+import (
+	"bytes"
+
+	"github.com/bytedance/sonic"
+)
+
+// OrderedMap is the decoded form of a struct: field values keyed by name,
+// iterated and marshalled in IDL declaration order.
+type OrderedMap struct {
+	keys   []string
+	values []interface{}
+	index  map[string]int
+	// shared is set while keys and index belong to a decode plan, Set
+	// copies them before adding a key.
+	shared bool
+}
+
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{}
+}
+
+// newPlannedOrderedMap returns a map with the keys of the named fields and
+// nil values.
+func newPlannedOrderedMap(fields *fieldsPlan) *OrderedMap {
+	return &OrderedMap{
+		keys:   fields.keys,
+		values: make([]interface{}, len(fields.keys)),
+		index:  fields.index,
+		shared: true,
+	}
+}
+
+func (m *OrderedMap) Set(key string, value interface{}) {
+	if i, ok := m.index[key]; ok {
+		m.values[i] = value
+		return
+	}
+	if m.shared {
+		index := make(map[string]int, len(m.index)+1)
+		for k, i := range m.index {
+			index[k] = i
+		}
+		m.index = index
+		m.keys = append(m.keys[:len(m.keys):len(m.keys)], key)
+		m.shared = false
+	} else {
+		if m.index == nil {
+			m.index = make(map[string]int)
+		}
+		m.keys = append(m.keys, key)
+	}
+	m.index[key] = len(m.values)
+	m.values = append(m.values, value)
+}
+
+func (m *OrderedMap) Get(key string) (interface{}, bool) {
+	i, ok := m.index[key]
+	if !ok {
+		return nil, false
+	}
+	return m.values[i], true
+}
+
+// Keys returns the keys in order. The slice must not be modified.
+func (m *OrderedMap) Keys() []string {
+	return m.keys
+}
+
+func (m *OrderedMap) Len() int {
+	return len(m.keys)
+}
+
+// Map returns a plain copy of the entries without ordering.
+func (m *OrderedMap) Map() map[string]interface{} {
+	res := make(map[string]interface{}, len(m.keys))
+	for i, k := range m.keys {
+		res[k] = m.values[i]
+	}
+	return res
+}
+
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		keyJson, err := sonic.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(keyJson)
+		buf.WriteByte(':')
+		valueJson, err := sonic.Marshal(m.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(valueJson)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// EnumValue is the decoded form of an enum. Fields is nil for unit variants,
+// an *OrderedMap for named variants and a []interface{} for tuple variants.
+type EnumValue struct {
+	Variant string
+	Fields  interface{}
+}
+
+// MarshalJSON keeps the {"Variant": fields} shape, with unit variants
+// marshalled as {"Variant": {}}.
+func (e *EnumValue) MarshalJSON() ([]byte, error) {
+	fields := e.Fields
+	if fields == nil {
+		fields = struct{}{}
+	}
+	return sonic.Marshal(map[string]interface{}{e.Variant: fields})
+}
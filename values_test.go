@@ -0,0 +1,58 @@
+package anchor_idl_parser
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const byteValuesIdl = `{
+  "address": "Byte111111111111111111111111111111111111111",
+  "metadata": {"name": "byte_values", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [
+    {"name": "set", "discriminator": [1], "accounts": [], "args": [
+      {"name": "b", "type": "bytes"},
+      {"name": "v", "type": {"vec": "u8"}},
+      {"name": "a", "type": {"array": ["u8", 2]}}]}
+  ]
+}`
+
+func TestExtractBytesAndByteVectors(t *testing.T) {
+	p, err := NewParserWithJson(byteValuesIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte{1, 2, 0, 0, 0, 1, 2, 2, 0, 0, 0, 3, 4, 5, 6}
+	res, err := p.InstructionParse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := res["data"].(map[string]interface{})
+	if b, ok := values["b"].([]byte); !ok || !reflect.DeepEqual(b, []byte{1, 2}) {
+		t.Errorf("bytes: got %#v, want []byte{1, 2}", values["b"])
+	}
+	if v := values["v"]; !reflect.DeepEqual(v, []interface{}{uint8(3), uint8(4)}) {
+		t.Errorf("vec<u8>: got %#v", v)
+	}
+	if a := values["a"]; !reflect.DeepEqual(a, []interface{}{uint8(5), uint8(6)}) {
+		t.Errorf("[u8; 2]: got %#v", a)
+	}
+	out, err := json.Marshal(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":[5,6],"b":"AQI=","v":[3,4]}`; string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+
+	// legacy output joins both alike
+	p.SetLegacyStringOutput(true)
+	res, err = p.InstructionParse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values = res["data"].(map[string]interface{})
+	if values["b"] != "1, 2" || values["v"] != "3, 4" {
+		t.Errorf("legacy: got %#v %#v", values["b"], values["v"])
+	}
+}
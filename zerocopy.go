@@ -0,0 +1,273 @@
+package anchor_idl_parser
+
+import (
+	"fmt"
+)
+
+const (
+	IdlSerializationBorsh          = "borsh"
+	IdlSerializationBytemuck       = "bytemuck"
+	IdlSerializationBytemuckUnsafe = "bytemuckunsafe"
+
+	IdlReprKindRust        = "rust"
+	IdlReprKindC           = "c"
+	IdlReprKindTransparent = "transparent"
+)
+
+// zeroCopyAligns are the primitive alignments of the SBF target zero copy
+// accounts are written by, where 128 bit integers are 8 byte aligned.
+var zeroCopyAligns = map[string]int{
+	"bool": 1,
+	"u8":   1,
+	"i8":   1,
+	"u16":  2,
+	"i16":  2,
+	"u32":  4,
+	"i32":  4,
+	"f32":  4,
+	"u64":  8,
+	"i64":  8,
+	"f64":  8,
+	"u128": 8,
+	"i128": 8,
+	"u256": 8,
+	"i256": 8,
+	// pubkeys are [u8; 32]
+	"pubkey":    1,
+	"publicKey": 1,
+}
+
+// IsZeroCopy reports whether values of the type are stored with their in
+// memory layout, as #[account(zero_copy)] accounts are, instead of Borsh.
+func (t *IdlTypeDef) IsZeroCopy() bool {
+	return t.Serialization == IdlSerializationBytemuck || t.Serialization == IdlSerializationBytemuckUnsafe
+}
+
+// zeroCopyLayout is the in memory layout of a fixed size type. runs are the
+// data bytes in field order; concatenated they are the Borsh encoding of the
+// same value, so padding is all that tells the two apart.
+type zeroCopyLayout struct {
+	size  int
+	align int
+	runs  []byteRun
+}
+
+type byteRun struct {
+	offset int
+	len    int
+}
+
+func (l *zeroCopyLayout) appendRuns(runs []byteRun, base int) {
+	for _, run := range runs {
+		last := len(l.runs) - 1
+		if last >= 0 && l.runs[last].offset+l.runs[last].len == base+run.offset {
+			l.runs[last].len += run.len
+			continue
+		}
+		l.runs = append(l.runs, byteRun{offset: base + run.offset, len: run.len})
+	}
+}
+
+// gather copies the data bytes of data, which holds the zero copy value,
+// into their Borsh order, stopping where data ends.
+func (l *zeroCopyLayout) gather(data []byte) []byte {
+	if len(l.runs) == 1 && l.runs[0].offset == 0 && l.runs[0].len <= len(data) {
+		return data[:l.runs[0].len]
+	}
+	res := make([]byte, 0, l.size)
+	for _, run := range l.runs {
+		if run.offset >= len(data) {
+			break
+		}
+		res = append(res, data[run.offset:min(run.offset+run.len, len(data))]...)
+	}
+	return res
+}
+
+// scatter places Borsh encoded bytes at their zero copy offsets, leaving
+// padding zeroed.
+func (l *zeroCopyLayout) scatter(buf []byte, borsh []byte) ([]byte, error) {
+	if size := l.borshSize(); len(borsh) != size {
+		return nil, newEncodeError("", ErrInvalidValue, "zero copy fields encoded to %d bytes, expected %d", len(borsh), size)
+	}
+	res := make([]byte, l.size)
+	pos := 0
+	for _, run := range l.runs {
+		copy(res[run.offset:run.offset+run.len], borsh[pos:])
+		pos += run.len
+	}
+	return append(buf, res...), nil
+}
+
+// offset maps an offset into the gathered Borsh bytes back to the zero copy
+// data.
+func (l *zeroCopyLayout) offset(borshOffset int) int {
+	pos := 0
+	for _, run := range l.runs {
+		if borshOffset < pos+run.len {
+			return run.offset + borshOffset - pos
+		}
+		pos += run.len
+	}
+	return l.size + borshOffset - pos
+}
+
+func (l *zeroCopyLayout) borshSize() int {
+	size := 0
+	for _, run := range l.runs {
+		size += run.len
+	}
+	return size
+}
+
+func alignUp(n int, align int) int {
+	return (n + align - 1) / align * align
+}
+
+// zeroCopyLayoutOf computes the in memory layout of argType. Types without
+// a fixed size, enums and generic array lengths cannot be zero copy.
+func (env *typeEnv) zeroCopyLayoutOf(argType *IdlType) (*zeroCopyLayout, error) {
+	return env.zeroCopyLayoutOfWithDepth(argType, 0)
+}
+
+func (env *typeEnv) zeroCopyLayoutOfWithDepth(argType *IdlType, depth int) (*zeroCopyLayout, error) {
+	if depth > maxRecursiveDepth {
+		return nil, ErrMaxDepthExceeded
+	}
+	switch {
+	case argType.Primitive != "":
+		size, ok := primitiveSize(argType.Primitive)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is not zero copy", ErrUnsupportedType, argType.Primitive)
+		}
+		align, ok := zeroCopyAligns[argType.Primitive]
+		if !ok {
+			align = 1
+		}
+		return &zeroCopyLayout{size: size, align: align, runs: []byteRun{{0, size}}}, nil
+	case argType.Array != nil:
+		if argType.Array.Len.Generic != "" {
+			return nil, fmt.Errorf("%w: array length %s is generic", ErrUnsupportedType, argType.Array.Len.Generic)
+		}
+		elem, err := env.zeroCopyLayoutOfWithDepth(&argType.Array.Elem, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		length := argType.Array.Len.Value
+		if elem.size > 0 && length > maxFixedSize/elem.size {
+			return nil, fmt.Errorf("%w: array of %d items is too large", ErrUnsupportedType, length)
+		}
+		res := &zeroCopyLayout{size: elem.size * length, align: elem.align}
+		for i := 0; i < length; i++ {
+			res.appendRuns(elem.runs, i*elem.size)
+		}
+		return res, nil
+	case argType.Defined != nil:
+		return env.zeroCopyLayoutOfDefined(argType.Defined, depth+1)
+	}
+	return nil, fmt.Errorf("%w: %s is not zero copy", ErrUnsupportedType, argType)
+}
+
+func (env *typeEnv) zeroCopyLayoutOfDefined(defined *IdlTypeDefined, depth int) (*zeroCopyLayout, error) {
+	if handler, ok := env.lookupType(defined.Name); ok {
+		if handler.Size <= 0 {
+			return nil, fmt.Errorf("%w: %s has no fixed size", ErrUnsupportedType, defined.Name)
+		}
+		return &zeroCopyLayout{size: handler.Size, align: 1, runs: []byteRun{{0, handler.Size}}}, nil
+	}
+	key := definedKey(defined)
+	if cached, ok := env.layouts.Load(key); ok {
+		return cached.(*zeroCopyLayout), nil
+	}
+	typeDef := env.findTypeDef(defined.Name)
+	typeData, err := env.resolve(defined)
+	if err != nil {
+		return nil, err
+	}
+	var layout *zeroCopyLayout
+	switch typeData.Kind {
+	case IdlTypeDefKindStruct:
+		layout, err = env.zeroCopyStructLayout(defined.Name, typeDef.Repr, typeData.Fields, depth)
+	case IdlTypeDefKindType:
+		if typeData.Alias == nil {
+			return nil, fmt.Errorf("%w: alias %s has no target", ErrUnsupportedType, defined.Name)
+		}
+		layout, err = env.zeroCopyLayoutOfWithDepth(typeData.Alias, depth+1)
+	default:
+		return nil, fmt.Errorf("%w: %s %s is not zero copy", ErrUnsupportedType, typeData.Kind, defined.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	env.layouts.Store(key, layout)
+	return layout, nil
+}
+
+// zeroCopyStructLayout lays fields out like repr(C): each field at the next
+// multiple of its alignment and the size rounded up to the struct alignment.
+// packed caps field alignment at align (1 when unset), align raises the
+// struct alignment, and transparent takes the layout of the only field.
+func (env *typeEnv) zeroCopyStructLayout(name string, repr *IdlRepr, fields *IdlDefinedFields, depth int) (*zeroCopyLayout, error) {
+	var types []*IdlType
+	if fields != nil {
+		if fields.IsTuple() {
+			for i := range fields.Tuple {
+				types = append(types, &fields.Tuple[i])
+			}
+		} else {
+			for i := range fields.Named {
+				types = append(types, &fields.Named[i].Type)
+			}
+		}
+	}
+	if repr == nil {
+		repr = &IdlRepr{Kind: IdlReprKindC}
+	}
+	if repr.Kind == IdlReprKindTransparent {
+		if len(types) != 1 {
+			return nil, fmt.Errorf("%w: transparent %s has %d fields", ErrInvalidIdl, name, len(types))
+		}
+		return env.zeroCopyLayoutOfWithDepth(types[0], depth+1)
+	}
+	packTo := 0
+	if repr.Packed {
+		packTo = 1
+		if repr.Align != nil && *repr.Align > 0 {
+			packTo = *repr.Align
+		}
+	}
+	res := &zeroCopyLayout{align: 1}
+	offset := 0
+	for _, t := range types {
+		field, err := env.zeroCopyLayoutOfWithDepth(t, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		align := field.align
+		if packTo > 0 {
+			align = min(align, packTo)
+		}
+		offset = alignUp(offset, align)
+		res.appendRuns(field.runs, offset)
+		offset += field.size
+		res.align = max(res.align, align)
+	}
+	if !repr.Packed && repr.Align != nil && *repr.Align > res.align {
+		res.align = *repr.Align
+	}
+	res.size = alignUp(offset, res.align)
+	return res, nil
+}
+
+// extractZeroCopyArgs decodes the fields of a zero copy value by gathering
+// its data bytes into Borsh order, with offsets mapped back for errors.
+func extractZeroCopyArgs(data []byte, args *fieldsPlan, layout *zeroCopyLayout, ctx *decodeContext) (map[string]interface{}, int) {
+	values, n := extractArgs(layout.gather(data), args, ctx)
+	if ctx.err != nil {
+		ctx.err.Offset = layout.offset(ctx.err.Offset)
+	}
+	if n < layout.borshSize() {
+		return values, layout.offset(n)
+	}
+	return values, layout.size
+}
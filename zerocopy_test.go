@@ -0,0 +1,170 @@
+package anchor_idl_parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+const zeroCopyIdl = `{
+  "address": "Zero111111111111111111111111111111111111111",
+  "metadata": {"name": "zero_copy", "version": "0.1.0", "spec": "0.1.0"},
+  "instructions": [],
+  "accounts": [
+    {"name": "Padded", "discriminator": [1]},
+    {"name": "Packed", "discriminator": [2]},
+    {"name": "PackedAlign", "discriminator": [3]},
+    {"name": "Aligned", "discriminator": [4]},
+    {"name": "Holder", "discriminator": [5]},
+    {"name": "Wide", "discriminator": [6]},
+    {"name": "Outer", "discriminator": [7]},
+    {"name": "External", "discriminator": [8]}
+  ],
+  "types": [
+    {"name": "Padded", "serialization": "bytemuck", "repr": {"kind": "c"},
+     "type": {"kind": "struct", "fields": [
+       {"name": "a", "type": "u8"}, {"name": "b", "type": "u32"}, {"name": "c", "type": "u16"}]}},
+    {"name": "Packed", "serialization": "bytemuck", "repr": {"kind": "c", "packed": true},
+     "type": {"kind": "struct", "fields": [
+       {"name": "a", "type": "u8"}, {"name": "b", "type": "u32"}, {"name": "c", "type": "u16"}]}},
+    {"name": "PackedAlign", "serialization": "bytemuck", "repr": {"kind": "c", "packed": true, "align": 2},
+     "type": {"kind": "struct", "fields": [
+       {"name": "a", "type": "u8"}, {"name": "b", "type": "u32"}, {"name": "c", "type": "u16"}]}},
+    {"name": "Aligned", "serialization": "bytemuck", "repr": {"kind": "c", "align": 16},
+     "type": {"kind": "struct", "fields": [
+       {"name": "a", "type": "u8"}, {"name": "b", "type": "u32"}]}},
+    {"name": "Wrapper", "repr": {"kind": "transparent"},
+     "type": {"kind": "struct", "fields": ["u64"]}},
+    {"name": "Holder", "serialization": "bytemuck", "repr": {"kind": "c"},
+     "type": {"kind": "struct", "fields": [
+       {"name": "w", "type": {"defined": {"name": "Wrapper"}}}, {"name": "a", "type": "u8"}]}},
+    {"name": "Wide", "serialization": "bytemuck", "repr": {"kind": "c"},
+     "type": {"kind": "struct", "fields": [
+       {"name": "a", "type": "u8"}, {"name": "b", "type": "u128"}]}},
+    {"name": "Outer", "serialization": "bytemuck",
+     "type": {"kind": "struct", "fields": [
+       {"name": "x", "type": "u8"}, {"name": "inner", "type": {"defined": {"name": "Padded"}}}]}},
+    {"name": "External", "serialization": "bytemuck", "repr": {"kind": "c"},
+     "type": {"kind": "struct", "fields": [
+       {"name": "d", "type": {"defined": {"name": "Ext"}}}, {"name": "a", "type": "u8"}, {"name": "b", "type": "u32"}]}}
+  ]
+}`
+
+func TestZeroCopyLayouts(t *testing.T) {
+	p, err := NewParserWithJson(zeroCopyIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		size  int
+		align int
+		runs  []byteRun
+		value map[string]interface{}
+		data  []byte
+	}{
+		{
+			name: "Padded", size: 12, align: 4,
+			runs:  []byteRun{{0, 1}, {4, 6}},
+			value: map[string]interface{}{"a": uint8(1), "b": uint32(0x02030405), "c": uint16(0x0607)},
+			data:  []byte{1, 0, 0, 0, 5, 4, 3, 2, 7, 6, 0, 0},
+		},
+		{
+			name: "Packed", size: 7, align: 1,
+			runs:  []byteRun{{0, 7}},
+			value: map[string]interface{}{"a": uint8(1), "b": uint32(0x02030405), "c": uint16(0x0607)},
+			data:  []byte{1, 5, 4, 3, 2, 7, 6},
+		},
+		{
+			name: "PackedAlign", size: 8, align: 2,
+			runs:  []byteRun{{0, 1}, {2, 6}},
+			value: map[string]interface{}{"a": uint8(1), "b": uint32(0x02030405), "c": uint16(0x0607)},
+			data:  []byte{1, 0, 5, 4, 3, 2, 7, 6},
+		},
+		{
+			name: "Aligned", size: 16, align: 16,
+			runs:  []byteRun{{0, 1}, {4, 4}},
+			value: map[string]interface{}{"a": uint8(1), "b": uint32(0x02030405)},
+			data:  []byte{1, 0, 0, 0, 5, 4, 3, 2, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name: "Holder", size: 16, align: 8,
+			runs:  []byteRun{{0, 9}},
+			value: map[string]interface{}{"w": []interface{}{uint64(9)}, "a": uint8(1)},
+			data:  []byte{9, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			// u128 is 8 byte aligned on SBF, unlike x86_64
+			name: "Wide", size: 24, align: 8,
+			runs:  []byteRun{{0, 1}, {8, 16}},
+			value: map[string]interface{}{"a": uint8(1), "b": "2"},
+			data:  []byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name: "Outer", size: 16, align: 4,
+			runs: []byteRun{{0, 1}, {4, 1}, {8, 6}},
+			value: map[string]interface{}{"x": uint8(8), "inner": map[string]interface{}{
+				"a": uint8(1), "b": uint32(0x02030405), "c": uint16(0x0607)}},
+			data: []byte{8, 0, 0, 0, 1, 0, 0, 0, 5, 4, 3, 2, 7, 6, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		_, plan := p.accountPlan(tt.name)
+		if plan.zeroCopyErr != nil {
+			t.Errorf("%s: %v", tt.name, plan.zeroCopyErr)
+			continue
+		}
+		layout := plan.zeroCopy
+		if layout.size != tt.size || layout.align != tt.align || !reflect.DeepEqual(layout.runs, tt.runs) {
+			t.Errorf("%s: got size %d align %d runs %v, want %d %d %v", tt.name, layout.size, layout.align, layout.runs, tt.size, tt.align, tt.runs)
+		}
+
+		data, err := p.AccountsEncode(tt.name, tt.value)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(data[1:], tt.data) {
+			t.Errorf("%s: encoded %v, want %v", tt.name, data[1:], tt.data)
+		}
+		res, err := p.AccountsParse(data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got, want := fmt.Sprint(plainValue(res["data"])), fmt.Sprint(tt.value); got != want {
+			t.Errorf("%s: decoded %s, want %s", tt.name, got, want)
+		}
+	}
+}
+
+func TestZeroCopyScatterSize(t *testing.T) {
+	p, err := NewParserWithJson(zeroCopyIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, plan := p.accountPlan("Padded")
+	if _, err := plan.zeroCopy.scatter(nil, []byte{1, 2}); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("got %v, want ErrInvalidValue", err)
+	}
+
+	// a handler that encodes fewer bytes than its declared size
+	err = p.RegisterType("Ext", TypeHandler{
+		Size: 8,
+		Decode: func(data []byte) (interface{}, int, error) {
+			return data[:8], 8, nil
+		},
+		Encode: func(value interface{}) ([]byte, error) {
+			return []byte{1}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := map[string]interface{}{"d": nil, "a": uint8(1), "b": uint32(2)}
+	if _, err := p.AccountsEncode("External", value); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("got %v, want ErrInvalidValue", err)
+	}
+}